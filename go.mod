@@ -5,6 +5,8 @@ go 1.15
 require (
 	cloud.google.com/go v0.64.0
 	cloud.google.com/go/storage v1.10.0
+	github.com/go-ldap/ldap/v3 v3.2.4
+	github.com/golang/protobuf v1.4.2
 	github.com/gorilla/websocket v1.4.2
 	go.mongodb.org/mongo-driver v1.4.1
 	golang.org/x/crypto v0.0.0-20200820211705-5c72a883971a
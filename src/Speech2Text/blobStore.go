@@ -0,0 +1,56 @@
+package Speech2Text
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+// BlobStore keeps uploaded audio files until they are recognized
+type BlobStore interface {
+	Put(ctx context.Context, name string, data []byte) error
+	Get(ctx context.Context, name string) ([]byte, error)
+	Reader(ctx context.Context, name string) (io.ReadCloser, error)
+	Delete(ctx context.Context, name string) error
+	// URI is the location of the object for engines that fetch it themselves
+	URI(name string) string
+}
+
+// NewBlobStore builds the store selected by the BLOB_STORE environment
+// variable: "gcs" (default, bucket in GCS_BUCKET), "local" (directory in
+// BLOB_DIR) or "memory"
+func NewBlobStore(ctx context.Context) (BlobStore, error) {
+	switch kind := os.Getenv("BLOB_STORE"); kind {
+	case "", "gcs":
+		bucket := os.Getenv("GCS_BUCKET")
+		if len(bucket) == 0 {
+			return nil, fmt.Errorf("GCS_BUCKET must be set to use the gcs blob store")
+		}
+		return NewGCSBlobStore(ctx, bucket)
+	case "local":
+		dir := os.Getenv("BLOB_DIR")
+		if len(dir) == 0 {
+			return nil, fmt.Errorf("BLOB_DIR must be set to use the local blob store")
+		}
+		return NewLocalBlobStore(dir)
+	case "memory":
+		return NewMemoryBlobStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown blob store: %s", kind)
+	}
+}
+
+// Audio references an uploaded file held in a BlobStore
+type Audio struct {
+	Store BlobStore
+	Name  string
+}
+
+func (a Audio) URI() string {
+	return a.Store.URI(a.Name)
+}
+
+func (a Audio) Open(ctx context.Context) (io.ReadCloser, error) {
+	return a.Store.Reader(ctx, a.Name)
+}
@@ -0,0 +1,82 @@
+package Speech2Text
+
+import (
+	"context"
+	"fmt"
+	"speech-to-text-back/src/server/account"
+	"strings"
+	"sync/atomic"
+)
+
+// FakeRecognizer answers every request with the same canned transcripts,
+// which lets the upload pipeline run without Google credentials
+type FakeRecognizer struct {
+	Transcripts []account.Transcript
+	count       int64
+}
+
+func NewFakeRecognizer() *FakeRecognizer {
+	return &FakeRecognizer{
+		Transcripts: []account.Transcript{
+			fakeTranscript(0, 1, "Hello, this is a test recording.", 0.92),
+			fakeTranscript(3, 2, "Thank you, the transcription works.", 0.87),
+		},
+	}
+}
+
+// fakeTranscript spreads the words of text half a second apart from start
+func fakeTranscript(start int64, speaker int8, text string, confidence float32) account.Transcript {
+	fields := strings.Fields(text)
+	words := make([]account.Word, len(fields))
+	offset := start * 1000
+	for i, field := range fields {
+		words[i] = account.Word{
+			StartTime:  millisToTime(offset),
+			EndTime:    millisToTime(offset + 500),
+			Word:       field,
+			Confidence: confidence,
+			SpeakerTag: speaker,
+		}
+		offset += 500
+	}
+	return account.Transcript{
+		Alternatives: []account.Alternative{
+			{
+				Confidence: confidence,
+				Transcript: text,
+				Words:      words,
+			},
+		},
+	}
+}
+
+func (f *FakeRecognizer) Recognize(_ context.Context, _ Audio, _ RecognitionConfig) (Operation, error) {
+	id := atomic.AddInt64(&f.count, 1)
+	return &fakeOperation{
+		name:        fmt.Sprintf("fake-%d", id),
+		transcripts: f.Transcripts,
+	}, nil
+}
+
+func (f *FakeRecognizer) Resume(_ context.Context, name string) (Operation, error) {
+	return &fakeOperation{
+		name:        name,
+		transcripts: f.Transcripts,
+	}, nil
+}
+
+type fakeOperation struct {
+	name        string
+	transcripts []account.Transcript
+}
+
+func (o *fakeOperation) Name() string {
+	return o.name
+}
+
+func (o *fakeOperation) Wait(_ context.Context, onProgress func(percent int32)) ([]account.Transcript, error) {
+	onProgress(100)
+	transcripts := make([]account.Transcript, len(o.transcripts))
+	copy(transcripts, o.transcripts)
+	return transcripts, nil
+}
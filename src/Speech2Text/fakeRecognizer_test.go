@@ -0,0 +1,79 @@
+package Speech2Text
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFakeRecognizer(t *testing.T) {
+	f := NewFakeRecognizer()
+	ctx := context.Background()
+
+	first, err := f.Recognize(ctx, Audio{Name: "a.wav"}, RecognitionConfig{Language: "en-US"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := f.Recognize(ctx, Audio{Name: "b.wav"}, RecognitionConfig{Language: "en-US"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Name() == second.Name() {
+		t.Errorf("operations share the name %s", first.Name())
+	}
+
+	resumed, err := f.Resume(ctx, first.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Name() != first.Name() {
+		t.Errorf("resumed %s as %s", first.Name(), resumed.Name())
+	}
+
+	var progress []int32
+	transcripts, err := first.Wait(ctx, func(percent int32) {
+		progress = append(progress, percent)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(progress) == 0 || progress[len(progress)-1] != 100 {
+		t.Errorf("progress %v does not end at 100", progress)
+	}
+	if len(transcripts) != len(f.Transcripts) {
+		t.Fatalf("got %d transcripts, want %d", len(transcripts), len(f.Transcripts))
+	}
+
+	// Results are normalized by the queue, which must not change the
+	// canned transcripts
+	for i := range transcripts {
+		transcripts[i].Normalize("en-US")
+	}
+	for i, transcript := range transcripts {
+		if transcript.LanguageCode != "en-US" || transcript.ResultEndTime.Duration() == 0 {
+			t.Errorf("transcript %d is not normalized: %+v", i, transcript)
+		}
+		if f.Transcripts[i].LanguageCode != "" {
+			t.Errorf("the canned transcript %d was changed", i)
+		}
+	}
+}
+
+func TestRecognizersForModel(t *testing.T) {
+	def, local := NewFakeRecognizer(), NewFakeRecognizer()
+	r := &Recognizers{Default: def, models: make(map[string]Recognizer)}
+	r.Register("local", local)
+
+	tests := []struct {
+		model string
+		want  Recognizer
+	}{
+		{"", def},
+		{"video", def},
+		{"local", local},
+	}
+	for _, test := range tests {
+		if got := r.ForModel(test.model); got != test.want {
+			t.Errorf("ForModel(%q) is not the expected recognizer", test.model)
+		}
+	}
+}
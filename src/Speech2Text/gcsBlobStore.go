@@ -0,0 +1,52 @@
+package Speech2Text
+
+import (
+	"cloud.google.com/go/storage"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+type GCSBlobStore struct {
+	client *storage.Client
+	bucket string
+}
+
+func NewGCSBlobStore(ctx context.Context, bucket string) (*GCSBlobStore, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &GCSBlobStore{client: client, bucket: bucket}, nil
+}
+
+func (g *GCSBlobStore) Put(ctx context.Context, name string, data []byte) error {
+	wc := g.client.Bucket(g.bucket).Object(name).NewWriter(ctx)
+	if _, err := wc.Write(data); err != nil {
+		_ = wc.Close()
+		return err
+	}
+	return wc.Close()
+}
+
+func (g *GCSBlobStore) Get(ctx context.Context, name string) ([]byte, error) {
+	rc, err := g.Reader(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+func (g *GCSBlobStore) Reader(ctx context.Context, name string) (io.ReadCloser, error) {
+	return g.client.Bucket(g.bucket).Object(name).NewReader(ctx)
+}
+
+func (g *GCSBlobStore) Delete(ctx context.Context, name string) error {
+	return g.client.Bucket(g.bucket).Object(name).Delete(ctx)
+}
+
+func (g *GCSBlobStore) URI(name string) string {
+	return fmt.Sprintf("gs://%s/%s", g.bucket, name)
+}
@@ -0,0 +1,116 @@
+package Speech2Text
+
+import (
+	speech "cloud.google.com/go/speech/apiv1"
+	"context"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+	"speech-to-text-back/src/server/account"
+	"strings"
+	"time"
+)
+
+// Time between two checks of a long running recognition
+const pollInterval = 5 * time.Second
+
+type GoogleRecognizer struct {
+	client *speech.Client
+}
+
+func NewGoogleRecognizer(ctx context.Context) (*GoogleRecognizer, error) {
+	client, err := speech.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &GoogleRecognizer{client: client}, nil
+}
+
+func (g *GoogleRecognizer) Recognize(ctx context.Context, audio Audio, config RecognitionConfig) (Operation, error) {
+	recognitionAudio, err := googleAudio(ctx, audio)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &speechpb.LongRunningRecognizeRequest{
+		Config: &speechpb.RecognitionConfig{
+			Encoding:                   config.Encoding,
+			SampleRateHertz:            config.SampleRateHertz,
+			LanguageCode:               config.Language,
+			EnableAutomaticPunctuation: true,
+			EnableWordTimeOffsets:      true,
+			UseEnhanced:                true,
+			Model:                      config.Model,
+			DiarizationConfig: &speechpb.SpeakerDiarizationConfig{
+				EnableSpeakerDiarization: true,
+				MinSpeakerCount:          2,
+				MaxSpeakerCount:          3,
+			},
+		},
+		Audio: recognitionAudio,
+	}
+	op, err := g.client.LongRunningRecognize(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &googleOperation{op: op}, nil
+}
+
+func (g *GoogleRecognizer) Resume(_ context.Context, name string) (Operation, error) {
+	return &googleOperation{op: g.client.LongRunningRecognizeOperation(name)}, nil
+}
+
+// googleAudio lets Google fetch files stored in GCS and sends the content
+// of any other store inline
+func googleAudio(ctx context.Context, audio Audio) (*speechpb.RecognitionAudio, error) {
+	uri := audio.URI()
+	if strings.HasPrefix(uri, "gs://") {
+		return &speechpb.RecognitionAudio{
+			AudioSource: &speechpb.RecognitionAudio_Uri{Uri: uri},
+		}, nil
+	}
+
+	content, err := audio.Store.Get(ctx, audio.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &speechpb.RecognitionAudio{
+		AudioSource: &speechpb.RecognitionAudio_Content{Content: content},
+	}, nil
+}
+
+type googleOperation struct {
+	op *speech.LongRunningRecognizeOperation
+}
+
+func (o *googleOperation) Name() string {
+	return o.op.Name()
+}
+
+func (o *googleOperation) Wait(ctx context.Context, onProgress func(percent int32)) ([]account.Transcript, error) {
+	var resp *speechpb.LongRunningRecognizeResponse
+	var err error
+	for {
+		resp, err = o.op.Poll(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if o.op.Done() {
+			break
+		}
+		if metadata, err := o.op.Metadata(); err == nil && metadata != nil {
+			onProgress(metadata.ProgressPercent)
+		}
+
+		select {
+		case <-time.After(pollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	onProgress(100)
+
+	transcripts := make([]account.Transcript, len(resp.Results))
+	for i, result := range resp.Results {
+		transcripts[i] = account.TranscriptFromResult(result)
+	}
+	return transcripts, nil
+}
@@ -0,0 +1,213 @@
+package Speech2Text
+
+import (
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"speech-to-text-back/src/server/account"
+	"time"
+)
+
+type JobState string
+
+const (
+	JobReceiving   JobState = account.StatusReceiving
+	JobUploaded    JobState = account.StatusUploaded
+	JobRecognizing JobState = account.StatusRecognizing
+	JobDone        JobState = account.StatusDone
+	JobFailed      JobState = account.StatusFailed
+)
+
+// Job is the persisted state of the transcription of one upload, so that it
+// can be picked up again after a restart
+type Job struct {
+	Id              bson.ObjectId                            `json:"_id" bson:"_id,omitempty"`
+	Translation     bson.ObjectId                            `json:"translation" bson:"translation"`
+	Blob            string                                   `json:"blob" bson:"blob"`
+	State           JobState                                 `json:"state" bson:"state"`
+	Operation       string                                   `json:"operation,omitempty" bson:"operation,omitempty"`
+	Encoding        speechpb.RecognitionConfig_AudioEncoding `json:"encoding" bson:"encoding"`
+	SampleRateHertz int32                                    `json:"sample_rate_hertz" bson:"sample_rate_hertz"`
+	Language        string                                   `json:"language" bson:"language"`
+	Model           string                                   `json:"model" bson:"model"`
+	Progress        int32                                    `json:"progress" bson:"progress"`
+	Error           string                                   `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedAt       time.Time                                `json:"created_at" bson:"created_at"`
+	UpdatedAt       time.Time                                `json:"updated_at" bson:"updated_at"`
+}
+
+func (j *Job) Config() RecognitionConfig {
+	return RecognitionConfig{
+		Encoding:        j.Encoding,
+		SampleRateHertz: j.SampleRateHertz,
+		Language:        j.Language,
+		Model:           j.Model,
+	}
+}
+
+func CreateJob(mongoSession *mgo.Session, translation bson.ObjectId, blob string, config RecognitionConfig) (*Job, error) {
+	sessionCopy := mongoSession.Copy()
+	defer sessionCopy.Close()
+	collection := sessionCopy.DB(account.Database).C("jobs")
+
+	now := time.Now()
+	job := Job{
+		Id:              bson.NewObjectId(),
+		Translation:     translation,
+		Blob:            blob,
+		State:           JobReceiving,
+		Encoding:        config.Encoding,
+		SampleRateHertz: config.SampleRateHertz,
+		Language:        config.Language,
+		Model:           config.Model,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+
+	if err := collection.Insert(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func FindJob(mongoSession *mgo.Session, id bson.ObjectId) (*Job, error) {
+	sessionCopy := mongoSession.Copy()
+	defer sessionCopy.Close()
+	collection := sessionCopy.DB(account.Database).C("jobs")
+
+	var job Job
+	if err := collection.FindId(id).One(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// PendingJobs lists the jobs that were not finished, oldest first
+func PendingJobs(mongoSession *mgo.Session) (jobs []Job, err error) {
+	sessionCopy := mongoSession.Copy()
+	defer sessionCopy.Close()
+	collection := sessionCopy.DB(account.Database).C("jobs")
+
+	err = collection.Find(bson.M{
+		"state": bson.M{
+			"$in": []JobState{JobReceiving, JobUploaded, JobRecognizing},
+		},
+	}).Sort("created_at").All(&jobs)
+	return jobs, err
+}
+
+// updateJob saves fields of job and mirrors its status on the translation
+func updateJob(mongoSession *mgo.Session, job *Job, fields bson.M) error {
+	sessionCopy := mongoSession.Copy()
+	defer sessionCopy.Close()
+	collection := sessionCopy.DB(account.Database).C("jobs")
+
+	job.UpdatedAt = time.Now()
+	fields["updated_at"] = job.UpdatedAt
+	err := collection.UpdateId(job.Id, bson.M{"$set": fields})
+	if err != nil {
+		return err
+	}
+
+	collection = sessionCopy.DB(account.Database).C("translations")
+	return collection.UpdateId(job.Translation, bson.M{
+		"$set": bson.M{
+			"status":   job.State,
+			"progress": job.Progress,
+			"error":    job.Error,
+		},
+	})
+}
+
+func setJobState(mongoSession *mgo.Session, job *Job, state JobState) error {
+	job.State = state
+	return updateJob(mongoSession, job, bson.M{"state": state})
+}
+
+func setJobOperation(mongoSession *mgo.Session, job *Job, operation string) error {
+	job.State = JobRecognizing
+	job.Operation = operation
+	return updateJob(mongoSession, job, bson.M{
+		"state":     job.State,
+		"operation": operation,
+	})
+}
+
+func finishJob(mongoSession *mgo.Session, job *Job) error {
+	job.State = JobDone
+	job.Progress = 100
+	return updateJob(mongoSession, job, bson.M{
+		"state":    job.State,
+		"progress": job.Progress,
+	})
+}
+
+func setJobProgress(mongoSession *mgo.Session, job *Job, percent int32) error {
+	job.Progress = percent
+	return updateJob(mongoSession, job, bson.M{"progress": percent})
+}
+
+func failJob(mongoSession *mgo.Session, job *Job, reason error) error {
+	job.State = JobFailed
+	job.Error = reason.Error()
+	return updateJob(mongoSession, job, bson.M{
+		"state": job.State,
+		"error": job.Error,
+	})
+}
+
+// failJobId marks the job id failed when it could not be loaded, along with
+// its translation when the job still exists
+func failJobId(mongoSession *mgo.Session, id bson.ObjectId, reason error) error {
+	sessionCopy := mongoSession.Copy()
+	defer sessionCopy.Close()
+
+	var job Job
+	_, err := sessionCopy.DB(account.Database).C("jobs").FindId(id).Apply(mgo.Change{
+		Update: bson.M{"$set": bson.M{
+			"state":      JobFailed,
+			"error":      reason.Error(),
+			"updated_at": time.Now(),
+		}},
+		ReturnNew: true,
+	}, &job)
+	if err != nil || len(job.Translation) == 0 {
+		return err
+	}
+
+	return sessionCopy.DB(account.Database).C("translations").UpdateId(job.Translation, bson.M{
+		"$set": bson.M{
+			"status": JobFailed,
+			"error":  reason.Error(),
+		},
+	})
+}
+
+// saveTranscripts replaces the transcripts of the translation, so that a job
+// resumed after a restart does not store its results twice
+func saveTranscripts(mongoSession *mgo.Session, job *Job, transcripts []account.Transcript) error {
+	sessionCopy := mongoSession.Copy()
+	defer sessionCopy.Close()
+	collection := sessionCopy.DB(account.Database).C("translations")
+
+	return collection.UpdateId(job.Translation, bson.M{
+		"$set": bson.M{
+			"transcripts": transcripts,
+			"duration":    account.SpeechDuration(transcripts),
+			"updated_at":  time.Now(),
+		},
+	})
+}
+
+// keepAudio records on the translation where its audio is stored
+func keepAudio(mongoSession *mgo.Session, job *Job) error {
+	sessionCopy := mongoSession.Copy()
+	defer sessionCopy.Close()
+	collection := sessionCopy.DB(account.Database).C("translations")
+
+	return collection.UpdateId(job.Translation, bson.M{
+		"$set": bson.M{
+			"audio": job.Blob,
+		},
+	})
+}
@@ -0,0 +1,52 @@
+package Speech2Text
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// LocalBlobStore keeps files in a directory of the local filesystem
+type LocalBlobStore struct {
+	dir string
+}
+
+func NewLocalBlobStore(dir string) (*LocalBlobStore, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(abs, 0700); err != nil {
+		return nil, err
+	}
+	return &LocalBlobStore{dir: abs}, nil
+}
+
+// path keeps names inside the store directory
+func (l *LocalBlobStore) path(name string) string {
+	return filepath.Join(l.dir, filepath.Base(filepath.Clean("/"+name)))
+}
+
+func (l *LocalBlobStore) Put(_ context.Context, name string, data []byte) error {
+	return ioutil.WriteFile(l.path(name), data, 0600)
+}
+
+func (l *LocalBlobStore) Get(_ context.Context, name string) ([]byte, error) {
+	return ioutil.ReadFile(l.path(name))
+}
+
+func (l *LocalBlobStore) Reader(_ context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(l.path(name))
+}
+
+func (l *LocalBlobStore) Delete(_ context.Context, name string) error {
+	return os.Remove(l.path(name))
+}
+
+func (l *LocalBlobStore) URI(name string) string {
+	u := url.URL{Scheme: "file", Path: l.path(name)}
+	return u.String()
+}
@@ -0,0 +1,350 @@
+package Speech2Text
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"speech-to-text-back/src/server/account"
+	"strings"
+	"sync/atomic"
+)
+
+// LocalRecognizer runs a speech engine installed on the server, so that the
+// audio never leaves the machine. The command is a template whose arguments
+// may contain the placeholders {input}, {output}, {language} and {model}.
+// The engine has to print its JSON result on stdout, or write it to
+// {output} (or {output}.json, as whisper.cpp does).
+type LocalRecognizer struct {
+	command []string
+	count   int64
+}
+
+func NewLocalRecognizer(command string) (*LocalRecognizer, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("LOCAL_RECOGNIZER_CMD must be set to use the local recognizer")
+	}
+	return &LocalRecognizer{command: fields}, nil
+}
+
+func (l *LocalRecognizer) Recognize(ctx context.Context, audio Audio, config RecognitionConfig) (Operation, error) {
+	dir, err := ioutil.TempDir("", "s2t-local-")
+	if err != nil {
+		return nil, err
+	}
+
+	input, err := localAudioPath(ctx, audio, dir)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+
+	output := filepath.Join(dir, "output")
+	replacer := strings.NewReplacer(
+		"{input}", input,
+		"{output}", output,
+		"{language}", config.Language,
+		"{model}", config.Model,
+	)
+	args := make([]string, len(l.command))
+	for i, arg := range l.command {
+		args[i] = replacer.Replace(arg)
+	}
+
+	op := &localOperation{
+		name:   fmt.Sprintf("local-%d", atomic.AddInt64(&l.count, 1)),
+		cmd:    exec.Command(args[0], args[1:]...),
+		dir:    dir,
+		output: output,
+		done:   make(chan error, 1),
+	}
+	op.cmd.Stdout = &op.stdout
+	op.cmd.Stderr = &op.stderr
+
+	if err = op.cmd.Start(); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	go func() {
+		op.done <- op.cmd.Wait()
+	}()
+
+	return op, nil
+}
+
+// Resume always fails, the engine process does not survive the server
+func (l *LocalRecognizer) Resume(_ context.Context, name string) (Operation, error) {
+	return nil, fmt.Errorf("local operation %s cannot be resumed", name)
+}
+
+// localAudioPath gives the engine a file on disk, copying the audio into dir
+// when the store is not a local directory
+func localAudioPath(ctx context.Context, audio Audio, dir string) (string, error) {
+	if u, err := url.Parse(audio.URI()); err == nil && u.Scheme == "file" {
+		return u.Path, nil
+	}
+
+	rc, err := audio.Open(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	path := filepath.Join(dir, "input"+filepath.Ext(audio.Name))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err = io.Copy(f, rc); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+type localOperation struct {
+	name   string
+	cmd    *exec.Cmd
+	dir    string
+	output string
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+	done   chan error
+}
+
+func (o *localOperation) Name() string {
+	return o.name
+}
+
+// Wait reports no progress, the engines we call do not print a machine
+// readable one
+func (o *localOperation) Wait(ctx context.Context, _ func(percent int32)) ([]account.Transcript, error) {
+	defer os.RemoveAll(o.dir)
+
+	select {
+	case err := <-o.done:
+		if err != nil {
+			return nil, fmt.Errorf("local recognizer failed: %v: %s", err, strings.TrimSpace(o.stderr.String()))
+		}
+	case <-ctx.Done():
+		_ = o.cmd.Process.Kill()
+		<-o.done
+		return nil, ctx.Err()
+	}
+
+	result := o.stdout.Bytes()
+	for _, path := range []string{o.output + ".json", o.output} {
+		if content, err := ioutil.ReadFile(path); err == nil {
+			result = content
+			break
+		}
+	}
+
+	return parseLocalOutput(result)
+}
+
+// localOutput covers the JSON printed by the engines we know: whisper.cpp
+// (transcription), openai-whisper and faster-whisper (segments) and Vosk
+// (result and text, possibly one object per utterance)
+type localOutput struct {
+	Transcription []whisperCppSegment `json:"transcription"`
+	Segments      []whisperSegment    `json:"segments"`
+	Result        []voskWord          `json:"result"`
+	Text          string              `json:"text"`
+}
+
+type whisperCppOffsets struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+type whisperCppToken struct {
+	Text    string            `json:"text"`
+	Offsets whisperCppOffsets `json:"offsets"`
+	P       float32           `json:"p"`
+}
+
+type whisperCppSegment struct {
+	Offsets whisperCppOffsets `json:"offsets"`
+	Text    string            `json:"text"`
+	Tokens  []whisperCppToken `json:"tokens"`
+}
+
+type whisperWord struct {
+	Word        string  `json:"word"`
+	Start       float64 `json:"start"`
+	End         float64 `json:"end"`
+	Probability float32 `json:"probability"`
+}
+
+type whisperSegment struct {
+	Start float64       `json:"start"`
+	End   float64       `json:"end"`
+	Text  string        `json:"text"`
+	Words []whisperWord `json:"words"`
+}
+
+type voskWord struct {
+	Word  string  `json:"word"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Conf  float32 `json:"conf"`
+}
+
+func parseLocalOutput(data []byte) ([]account.Transcript, error) {
+	transcripts := make([]account.Transcript, 0)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var output localOutput
+		err := decoder.Decode(&output)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not parse local recognizer output: %v", err)
+		}
+
+		for _, segment := range output.Transcription {
+			transcripts = append(transcripts, whisperCppTranscript(segment))
+		}
+		for _, segment := range output.Segments {
+			transcripts = append(transcripts, whisperTranscript(segment))
+		}
+		if len(output.Transcription) == 0 && len(output.Segments) == 0 && len(output.Text) > 0 {
+			transcripts = append(transcripts, voskTranscript(output.Result, output.Text))
+		}
+	}
+	return transcripts, nil
+}
+
+func secondsToTime(seconds float64) account.ResultEndTime {
+	return millisToTime(int64(seconds*1000 + 0.5))
+}
+
+// whisperCppTranscript rebuilds words from the segment tokens, a token that
+// does not start with a space continuing the previous word
+func whisperCppTranscript(segment whisperCppSegment) account.Transcript {
+	words := make([]account.Word, 0)
+	var confidence, count float32
+	for _, token := range segment.Tokens {
+		if strings.HasPrefix(token.Text, "[_") || strings.HasPrefix(token.Text, "<|") {
+			continue
+		}
+		confidence += token.P
+		count++
+		if len(words) > 0 && !strings.HasPrefix(token.Text, " ") {
+			last := &words[len(words)-1]
+			last.Word += token.Text
+			last.EndTime = millisToTime(token.Offsets.To)
+			if token.P < last.Confidence {
+				last.Confidence = token.P
+			}
+			continue
+		}
+		words = append(words, account.Word{
+			StartTime:  millisToTime(token.Offsets.From),
+			EndTime:    millisToTime(token.Offsets.To),
+			Word:       strings.TrimSpace(token.Text),
+			Confidence: token.P,
+		})
+	}
+	if len(segment.Tokens) == 0 {
+		words = spreadWords(segment.Text, segment.Offsets.From, segment.Offsets.To)
+	}
+	if count > 0 {
+		confidence /= count
+	}
+
+	return account.Transcript{
+		Alternatives: []account.Alternative{
+			{
+				Confidence: confidence,
+				Transcript: strings.TrimSpace(segment.Text),
+				Words:      words,
+			},
+		},
+	}
+}
+
+func whisperTranscript(segment whisperSegment) account.Transcript {
+	words := make([]account.Word, len(segment.Words))
+	var confidence float32
+	for i, word := range segment.Words {
+		confidence += word.Probability
+		words[i] = account.Word{
+			StartTime:  secondsToTime(word.Start),
+			EndTime:    secondsToTime(word.End),
+			Word:       strings.TrimSpace(word.Word),
+			Confidence: word.Probability,
+		}
+	}
+	if len(segment.Words) == 0 {
+		words = spreadWords(segment.Text, int64(segment.Start*1000), int64(segment.End*1000))
+	} else {
+		confidence /= float32(len(segment.Words))
+	}
+
+	return account.Transcript{
+		Alternatives: []account.Alternative{
+			{
+				Confidence: confidence,
+				Transcript: strings.TrimSpace(segment.Text),
+				Words:      words,
+			},
+		},
+	}
+}
+
+func voskTranscript(result []voskWord, text string) account.Transcript {
+	words := make([]account.Word, len(result))
+	var confidence float32
+	for i, word := range result {
+		confidence += word.Conf
+		words[i] = account.Word{
+			StartTime:  secondsToTime(word.Start),
+			EndTime:    secondsToTime(word.End),
+			Word:       word.Word,
+			Confidence: word.Conf,
+		}
+	}
+	if len(result) > 0 {
+		confidence /= float32(len(result))
+	}
+
+	return account.Transcript{
+		Alternatives: []account.Alternative{
+			{
+				Confidence: confidence,
+				Transcript: strings.TrimSpace(text),
+				Words:      words,
+			},
+		},
+	}
+}
+
+// spreadWords splits text evenly over a segment for engines without word timings
+func spreadWords(text string, from, to int64) []account.Word {
+	fields := strings.Fields(text)
+	words := make([]account.Word, len(fields))
+	if len(fields) == 0 {
+		return words
+	}
+	step := (to - from) / int64(len(fields))
+	for i, field := range fields {
+		start := from + int64(i)*step
+		words[i] = account.Word{
+			StartTime: millisToTime(start),
+			EndTime:   millisToTime(start + step),
+			Word:      field,
+		}
+	}
+	return words
+}
@@ -0,0 +1,58 @@
+package Speech2Text
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// MemoryBlobStore keeps files in memory, they are lost when the server stops
+type MemoryBlobStore struct {
+	mu    sync.RWMutex
+	blobs map[string][]byte
+}
+
+func NewMemoryBlobStore() *MemoryBlobStore {
+	return &MemoryBlobStore{blobs: make(map[string][]byte)}
+}
+
+func (m *MemoryBlobStore) Put(_ context.Context, name string, data []byte) error {
+	stored := make([]byte, len(data))
+	copy(stored, data)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.blobs[name] = stored
+	return nil
+}
+
+func (m *MemoryBlobStore) Get(_ context.Context, name string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	data, ok := m.blobs[name]
+	if !ok {
+		return nil, fmt.Errorf("blob not found: %s", name)
+	}
+	return data, nil
+}
+
+func (m *MemoryBlobStore) Reader(ctx context.Context, name string) (io.ReadCloser, error) {
+	data, err := m.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *MemoryBlobStore) Delete(_ context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.blobs, name)
+	return nil
+}
+
+func (m *MemoryBlobStore) URI(name string) string {
+	return fmt.Sprintf("mem://%s", name)
+}
@@ -0,0 +1,197 @@
+package Speech2Text
+
+import (
+	"context"
+	"errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"log"
+	"speech-to-text-back/src/server/account"
+	"sync"
+)
+
+// JobEvent tells the uploader how its job progresses and ends
+type JobEvent struct {
+	State       JobState
+	Percent     int32
+	Transcripts []account.Transcript
+	Err         error
+}
+
+// Queue runs the recognition of uploaded files on a pool of workers. Jobs
+// are persisted, so the ones interrupted by a restart are picked up again
+// by Start.
+type Queue struct {
+	mongoSession *mgo.Session
+	recognizers  *Recognizers
+	BlobStore    BlobStore
+	// KeepAudio keeps uploaded files once recognized, for share links
+	KeepAudio bool
+	pending   chan bson.ObjectId
+	mu        sync.Mutex
+	watchers  map[bson.ObjectId][]chan JobEvent
+}
+
+func NewQueue(mongoSession *mgo.Session, recognizers *Recognizers, blobStore BlobStore) *Queue {
+	return &Queue{
+		mongoSession: mongoSession,
+		recognizers:  recognizers,
+		BlobStore:    blobStore,
+		pending:      make(chan bson.ObjectId),
+		watchers:     make(map[bson.ObjectId][]chan JobEvent),
+	}
+}
+
+// Start launches the workers and requeues the jobs left by a previous run
+func (q *Queue) Start(workers int) error {
+	jobs, err := PendingJobs(q.mongoSession)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+
+	for i := range jobs {
+		job := &jobs[i]
+		if job.State == JobReceiving {
+			// The websocket that was sending the file is gone
+			_ = failJob(q.mongoSession, job, errors.New("upload interrupted by a server restart"))
+			continue
+		}
+		log.Printf("resuming job %s in state %s", job.Id.Hex(), job.State)
+		q.enqueue(job.Id)
+	}
+	return nil
+}
+
+func (q *Queue) enqueue(id bson.ObjectId) {
+	go func() {
+		q.pending <- id
+	}()
+}
+
+// Submit marks the file of job as uploaded and queues its recognition, the
+// returned channel receives the outcome
+func (q *Queue) Submit(job *Job) (<-chan JobEvent, error) {
+	if err := setJobState(q.mongoSession, job, JobUploaded); err != nil {
+		return nil, err
+	}
+	events := q.Watch(job.Id)
+	q.enqueue(job.Id)
+	return events, nil
+}
+
+// Fail ends a job that could not be uploaded
+func (q *Queue) Fail(job *Job, reason error) error {
+	return failJob(q.mongoSession, job, reason)
+}
+
+// Watch returns a channel receiving the progress of a job, it is closed once
+// the job is done or failed
+func (q *Queue) Watch(id bson.ObjectId) <-chan JobEvent {
+	events := make(chan JobEvent, 8)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.watchers[id] = append(q.watchers[id], events)
+	return events
+}
+
+func (q *Queue) notify(id bson.ObjectId, event JobEvent) {
+	q.mu.Lock()
+	watchers := q.watchers[id]
+	delete(q.watchers, id)
+	q.mu.Unlock()
+
+	for _, events := range watchers {
+		events <- event
+		close(events)
+	}
+}
+
+// progress is dropped for watchers that are not keeping up
+func (q *Queue) progress(id bson.ObjectId, percent int32) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, events := range q.watchers[id] {
+		select {
+		case events <- JobEvent{State: JobRecognizing, Percent: percent}:
+		default:
+		}
+	}
+}
+
+func (q *Queue) work() {
+	for id := range q.pending {
+		job, err := FindJob(q.mongoSession, id)
+		if err != nil {
+			log.Printf("job %s: %v", id.Hex(), err)
+			_ = failJobId(q.mongoSession, id, err)
+			q.notify(id, JobEvent{State: JobFailed, Err: err})
+			continue
+		}
+
+		transcripts, err := q.run(job)
+		if err != nil {
+			log.Printf("job %s failed: %v", id.Hex(), err)
+			_ = failJob(q.mongoSession, job, err)
+			q.notify(id, JobEvent{State: JobFailed, Err: err})
+			continue
+		}
+
+		_ = finishJob(q.mongoSession, job)
+		if q.KeepAudio {
+			_ = keepAudio(q.mongoSession, job)
+		} else if err = q.BlobStore.Delete(context.Background(), job.Blob); err != nil {
+			log.Printf("job %s: could not delete %s: %v", id.Hex(), job.Blob, err)
+		}
+		q.notify(id, JobEvent{State: JobDone, Transcripts: transcripts})
+	}
+}
+
+func (q *Queue) run(job *Job) ([]account.Transcript, error) {
+	ctx := context.Background()
+	recognizer := q.recognizers.ForModel(job.Model)
+
+	var op Operation
+	var err error
+	if job.State == JobRecognizing && len(job.Operation) > 0 {
+		op, err = recognizer.Resume(ctx, job.Operation)
+		if err != nil {
+			log.Printf("job %s: cannot resume %s, recognizing again: %v", job.Id.Hex(), job.Operation, err)
+		}
+	}
+
+	if op == nil {
+		op, err = recognizer.Recognize(ctx, Audio{Store: q.BlobStore, Name: job.Blob}, job.Config())
+		if err != nil {
+			return nil, err
+		}
+		if err = setJobOperation(q.mongoSession, job, op.Name()); err != nil {
+			return nil, err
+		}
+	}
+
+	lastPercent := int32(-1)
+	transcripts, err := op.Wait(ctx, func(percent int32) {
+		if percent == lastPercent {
+			return
+		}
+		lastPercent = percent
+		_ = setJobProgress(q.mongoSession, job, percent)
+		q.progress(job.Id, percent)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range transcripts {
+		transcripts[i].Normalize(job.Language)
+	}
+
+	if err = saveTranscripts(q.mongoSession, job, transcripts); err != nil {
+		return nil, err
+	}
+	return transcripts, nil
+}
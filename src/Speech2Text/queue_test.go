@@ -0,0 +1,104 @@
+package Speech2Text
+
+import (
+	"context"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"os"
+	"speech-to-text-back/src/server/account"
+	"testing"
+	"time"
+)
+
+// testMongo connects to MONGO_TEST_HOST, the test being skipped when it is
+// not set, and points the server to a throwaway database dropped once the
+// test is over
+func testMongo(t *testing.T) *mgo.Session {
+	host := os.Getenv("MONGO_TEST_HOST")
+	if len(host) == 0 {
+		t.Skip("MONGO_TEST_HOST is not set")
+	}
+	session, err := mgo.Dial(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	database := account.Database
+	account.Database = "s2t_test_" + bson.NewObjectId().Hex()
+	t.Cleanup(func() {
+		_ = session.DB(account.Database).DropDatabase()
+		account.Database = database
+		session.Close()
+	})
+	return session
+}
+
+// TestQueuePipeline runs an upload through the queue and the fake
+// recognizer, as a websocket upload does once the file is received
+func TestQueuePipeline(t *testing.T) {
+	mongoSession := testMongo(t)
+	fake := NewFakeRecognizer()
+	store := NewMemoryBlobStore()
+	queue := NewQueue(mongoSession, &Recognizers{Default: fake, models: make(map[string]Recognizer)}, store)
+	if err := queue.Start(1); err != nil {
+		t.Fatal(err)
+	}
+
+	owner := account.Account{Name: "pipeline", Password: "password"}
+	if err := account.CreateAccount(&owner, mongoSession); err != nil {
+		t.Fatal(err)
+	}
+
+	translation, err := account.CreateTranslation(mongoSession, account.Upload{FileName: "test.wav", Size: 4}, owner.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := CreateJob(mongoSession, translation.Id, translation.Id.Hex()+".wav", RecognitionConfig{Language: "en-US"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Put(context.Background(), job.Blob, []byte("RIFF")); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := queue.Submit(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last JobEvent
+	timeout := time.After(10 * time.Second)
+	for done := false; !done; {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				done = true
+				break
+			}
+			last = event
+		case <-timeout:
+			t.Fatal("the job did not finish")
+		}
+	}
+
+	if last.State != JobDone || last.Err != nil {
+		t.Fatalf("job ended in %s: %v", last.State, last.Err)
+	}
+	if len(last.Transcripts) != len(fake.Transcripts) {
+		t.Errorf("got %d transcripts, want %d", len(last.Transcripts), len(fake.Transcripts))
+	}
+
+	var saved account.Translation
+	if err = mongoSession.DB(account.Database).C("translations").FindId(translation.Id).One(&saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != account.StatusDone || len(saved.Transcripts) != len(fake.Transcripts) {
+		t.Errorf("translation saved as %s with %d transcripts", saved.Status, len(saved.Transcripts))
+	}
+	if saved.Duration == 0 {
+		t.Error("the duration of the speech was not recorded")
+	}
+	if _, err = store.Get(context.Background(), job.Blob); err == nil {
+		t.Error("the audio was kept")
+	}
+}
@@ -0,0 +1,101 @@
+package Speech2Text
+
+import (
+	"context"
+	"fmt"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+	"os"
+	"speech-to-text-back/src/server/account"
+	"strings"
+)
+
+// RecognitionConfig describes the audio handed to a Recognizer
+type RecognitionConfig struct {
+	Encoding        speechpb.RecognitionConfig_AudioEncoding
+	SampleRateHertz int32
+	Language        string
+	Model           string
+}
+
+// Operation is a recognition started by a Recognizer
+type Operation interface {
+	Name() string
+	// Wait blocks until the results are ready, reporting the completion
+	// percentage to onProgress when the engine provides it
+	Wait(ctx context.Context, onProgress func(percent int32)) ([]account.Transcript, error)
+}
+
+// Recognizer submits an uploaded audio file to a speech engine
+type Recognizer interface {
+	Recognize(ctx context.Context, audio Audio, config RecognitionConfig) (Operation, error)
+	// Resume finds an operation started before a restart by its name
+	Resume(ctx context.Context, name string) (Operation, error)
+}
+
+// NewRecognizer builds the recognizer named by kind, "google" being the default
+func NewRecognizer(ctx context.Context, kind string) (Recognizer, error) {
+	switch kind {
+	case "", "google":
+		return NewGoogleRecognizer(ctx)
+	case "fake":
+		return NewFakeRecognizer(), nil
+	case "local":
+		return NewLocalRecognizer(os.Getenv("LOCAL_RECOGNIZER_CMD"))
+	}
+	return nil, fmt.Errorf("unknown recognizer: %s", kind)
+}
+
+// Recognizers picks the engine of an upload from the model it asks for
+type Recognizers struct {
+	Default Recognizer
+	models  map[string]Recognizer
+}
+
+// NewRecognizers uses the engine named by RECOGNIZER by default, and routes
+// the models listed in LOCAL_RECOGNIZER_MODELS (default "local") to the
+// local engine when LOCAL_RECOGNIZER_CMD is set
+func NewRecognizers(ctx context.Context) (*Recognizers, error) {
+	def, err := NewRecognizer(ctx, os.Getenv("RECOGNIZER"))
+	if err != nil {
+		return nil, err
+	}
+	r := &Recognizers{
+		Default: def,
+		models:  make(map[string]Recognizer),
+	}
+
+	command := os.Getenv("LOCAL_RECOGNIZER_CMD")
+	if len(command) == 0 {
+		return r, nil
+	}
+	local, err := NewLocalRecognizer(command)
+	if err != nil {
+		return nil, err
+	}
+	models := os.Getenv("LOCAL_RECOGNIZER_MODELS")
+	if len(models) == 0 {
+		models = "local"
+	}
+	for _, model := range strings.Split(models, ",") {
+		r.Register(strings.TrimSpace(model), local)
+	}
+	return r, nil
+}
+
+func (r *Recognizers) Register(model string, recognizer Recognizer) {
+	r.models[model] = recognizer
+}
+
+func (r *Recognizers) ForModel(model string) Recognizer {
+	if recognizer, ok := r.models[model]; ok {
+		return recognizer
+	}
+	return r.Default
+}
+
+func millisToTime(millis int64) account.ResultEndTime {
+	return account.ResultEndTime{
+		Seconds: millis / 1000,
+		Nanos:   int32(millis%1000) * 1000000,
+	}
+}
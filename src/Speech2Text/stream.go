@@ -1,233 +1,187 @@
 package Speech2Text
 
 import (
-	speech "cloud.google.com/go/speech/apiv1"
-	"cloud.google.com/go/storage"
 	"context"
 	"encoding/json"
-	"fmt"
-	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
-	"gopkg.in/mgo.v2"
-	"gopkg.in/mgo.v2/bson"
-	"log"
-	"speech-to-text-back/src/server/account"
+	"errors"
+	"sync"
 	"time"
 )
 
+type ProgressType string
+
+const (
+	ProgressReceived    ProgressType = "received"
+	ProgressUploaded    ProgressType = "uploaded"
+	ProgressRecognizing ProgressType = "recognizing"
+	ProgressDone        ProgressType = "done"
+)
+
+// Progress of an upload reported to the websocket
+type Progress struct {
+	Type     ProgressType
+	Received int
+	Size     int
+	Percent  int32
+}
+
+// Stream receives an uploaded file from a websocket and hands it over to the
+// job queue
 type Stream struct {
-	ctx             context.Context
-	speechClient    *speech.Client
-	fileBuffer      chan []byte
-	StreamResp      chan []byte
-	StreamErr       chan []byte
-	Closed          bool
-	size            int
-	mongoSession    *mgo.Session
-	translation     *account.Translation
-	sampleRateHertz int32
-	language        string
-	audioType       speechpb.RecognitionConfig_AudioEncoding
-	model           string
-	streamsCount    int8
-	inputEOF        bool
-	fileName        string
-	uploadBuffer    []byte
+	ctx            context.Context
+	queue          *Queue
+	job            *Job
+	fileBuffer     chan []byte
+	StreamResp     chan []byte
+	StreamErr      chan []byte
+	StreamProgress chan Progress
+	// done is closed along with the websocket, so that nothing waits for it
+	done         chan struct{}
+	closeOnce    *sync.Once
+	size         int
+	uploadBuffer []byte
 }
 
 func NewStream(ctx context.Context,
-	fileName string,
 	fileBuffer chan []byte,
-	mongoSession *mgo.Session,
-	t *account.Translation,
-	size, sampleRateHertz int,
-	audioType speechpb.RecognitionConfig_AudioEncoding,
-	language string,
-	model string) Stream {
-	client, err := speech.NewClient(ctx)
-	if err != nil {
-		log.Fatal(err)
-	}
+	queue *Queue,
+	job *Job,
+	size int) Stream {
 	stream := Stream{
-		ctx:             ctx,
-		speechClient:    client,
-		fileBuffer:      fileBuffer,
-		Closed:          false,
-		StreamResp:      make(chan []byte),
-		StreamErr:       make(chan []byte),
-		size:            size,
-		mongoSession:    mongoSession,
-		translation:     t,
-		sampleRateHertz: int32(sampleRateHertz),
-		audioType:       audioType,
-		language:        language,
-		model:           model,
-		streamsCount:    0,
-		inputEOF:        false,
-		uploadBuffer:    []byte{},
-		fileName:        fileName,
+		ctx:            ctx,
+		queue:          queue,
+		job:            job,
+		fileBuffer:     fileBuffer,
+		done:           make(chan struct{}),
+		closeOnce:      &sync.Once{},
+		StreamResp:     make(chan []byte),
+		StreamErr:      make(chan []byte),
+		StreamProgress: make(chan Progress, 16),
+		size:           size,
+		uploadBuffer:   []byte{},
 	}
 
 	return stream
 }
 
-func (s *Stream) listenForFile() {
+// listenForFile gathers the uploaded file, and tells whether all of it
+// arrived before the websocket closed or 10s went by without data
+func (s *Stream) listenForFile() bool {
 	currentSize := 0
-	shouldReset := make(chan bool)
-	// A basic scheduler to close the loop after 10sc without receiving data
-	go func() {
-		for {
-			time.Sleep(time.Second * 10)
-			shouldReset <- true
-			shouldBreak := <-shouldReset
-			if shouldBreak {
-				return
-			}
-		}
-	}()
-
-	msgReceived := false
+	silence := time.NewTimer(time.Second * 10)
+	defer silence.Stop()
 
 	for currentSize < s.size {
 		select {
 		case fileBuffer := <-s.fileBuffer:
-			msgReceived = true
 			s.uploadBuffer = append(s.uploadBuffer, fileBuffer...)
 			currentSize += len(fileBuffer)
-		case <-shouldReset:
-			if !msgReceived {
-				shouldReset <- true
-				return
+			s.sendProgress(Progress{Type: ProgressReceived, Received: currentSize, Size: s.size}, false)
+			if !silence.Stop() {
+				<-silence.C
 			}
-			shouldReset <- false
-			msgReceived = false
+			silence.Reset(time.Second * 10)
+		case <-silence.C:
+			return false
+		case <-s.done:
+			return false
 		}
 	}
-	shouldReset <- true
+	return true
 }
 
-func (s *Stream) uploadFile() {
-	// bucket := "bucket-name"
-	// object := "object-name"
-	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
+// Close tells the stream the websocket is closed
+func (s *Stream) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+}
 
-	if err != nil {
-		serialized, _ := json.Marshal(err)
+// sendProgress drops the update when the websocket is not keeping up, unless
+// it must be delivered
+func (s *Stream) sendProgress(progress Progress, mustDeliver bool) {
+	if mustDeliver {
 		select {
-		case s.StreamErr <- serialized:
+		case s.StreamProgress <- progress:
+		case <-s.done:
 		}
 		return
 	}
+	select {
+	case s.StreamProgress <- progress:
+	default:
+	}
+}
 
-	defer client.Close()
+func (s *Stream) sendError(err error) {
+	serialized, _ := json.Marshal(err.Error())
+	select {
+	case s.StreamErr <- serialized:
+	case <-s.done:
+	}
+}
 
-	ctx, cancel := context.WithTimeout(ctx, time.Second*600)
+func (s *Stream) uploadFile() bool {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Second*600)
 	defer cancel()
 
-	// Upload an object with storage.Writer.
-	wc := client.Bucket("petlabspeechtool").Object(s.fileName).NewWriter(ctx)
-	if _, err = wc.Write(s.uploadBuffer); err != nil {
-		serialized, _ := json.Marshal(err)
-		select {
-		case s.StreamErr <- serialized:
-		}
-		return
+	if len(s.uploadBuffer) == 0 {
+		err := errors.New("no data received")
+		_ = s.queue.Fail(s.job, err)
+		s.sendError(err)
+		return false
 	}
-	if err := wc.Close(); err != nil {
-		serialized, _ := json.Marshal(err)
-		select {
-		case s.StreamErr <- serialized:
-		}
-		return
+
+	if err := s.queue.BlobStore.Put(ctx, s.job.Blob, s.uploadBuffer); err != nil {
+		_ = s.queue.Fail(s.job, err)
+		s.sendError(err)
+		return false
 	}
 	s.uploadBuffer = []byte{}
+	s.sendProgress(Progress{Type: ProgressUploaded, Received: s.size, Size: s.size}, true)
+	return true
 }
 
+// translate queues the recognition and waits for it, the job goes on even if
+// the websocket is closed meanwhile
 func (s *Stream) translate() {
-	ctx := context.Background()
-	req := &speechpb.LongRunningRecognizeRequest{
-		Config: &speechpb.RecognitionConfig{
-			Encoding:                   s.audioType,
-			SampleRateHertz:            s.sampleRateHertz,
-			LanguageCode:               s.language,
-			EnableAutomaticPunctuation: true,
-			UseEnhanced:                true,
-			Model:                      s.model,
-			DiarizationConfig: &speechpb.SpeakerDiarizationConfig{
-				EnableSpeakerDiarization: true,
-				MinSpeakerCount:          2,
-				MaxSpeakerCount:          3,
-			},
-		},
-		Audio: &speechpb.RecognitionAudio{
-			AudioSource: &speechpb.RecognitionAudio_Uri{Uri: fmt.Sprintf("gs://petlabspeechtool/%s", s.fileName)},
-		},
-	}
-	op, err := s.speechClient.LongRunningRecognize(ctx, req)
+	events, err := s.queue.Submit(s.job)
 	if err != nil {
-		serialized, _ := json.Marshal(err)
-		select {
-		case s.StreamErr <- serialized:
-		}
-		return
-	}
-	resp, err := op.Wait(ctx)
-	if err != nil {
-		serialized, _ := json.Marshal(err)
-		select {
-		case s.StreamErr <- serialized:
-		}
+		s.sendError(err)
 		return
 	}
 
-	// Print the results.
-	for _, result := range resp.Results {
-		serialized, _ := json.Marshal(account.TranscriptFromResult(result))
-		sessionCopy := s.mongoSession.Copy()
-		collection := sessionCopy.DB("s2t").C("translations")
-		query := bson.M{
-			"$push": bson.M{
-				"transcripts": result,
-			},
-		}
-		_ = collection.UpdateId(s.translation.Id, query)
-		sessionCopy.Close()
-		if !s.Closed {
-			select {
-			case s.StreamErr <- serialized:
-			}
+	var event JobEvent
+	for event = range events {
+		if event.State == JobRecognizing {
+			s.sendProgress(Progress{Type: ProgressRecognizing, Percent: event.Percent}, false)
 		}
 	}
-}
-
-func (s *Stream) deleteFile() {
-	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
-
-	if err != nil {
-		serialized, _ := json.Marshal(err)
-		select {
-		case s.StreamErr <- serialized:
-		}
+	if event.Err != nil {
+		s.sendError(event.Err)
 		return
 	}
 
-	if err = client.Bucket("petlabspeechtool").Object(s.fileName).Delete(ctx); err != nil {
-		serialized, _ := json.Marshal(err)
+	for _, transcript := range event.Transcripts {
+		serialized, _ := json.Marshal(transcript)
 		select {
-		case s.StreamErr <- serialized:
+		case s.StreamResp <- serialized:
+		case <-s.done:
 		}
-		return
 	}
+	s.sendProgress(Progress{Type: ProgressDone, Percent: 100}, true)
 }
 
 func (s *Stream) Start() {
-	s.listenForFile()
-	println("Done listening")
-	s.uploadFile()
-	println("Done uploading")
+	// A truncated file is not recognized
+	if !s.listenForFile() {
+		err := errors.New("upload incomplete")
+		_ = s.queue.Fail(s.job, err)
+		s.sendError(err)
+		return
+	}
+	if !s.uploadFile() {
+		return
+	}
 	s.translate()
-	println("Done translating")
-	s.deleteFile()
-	println("Done deleting")
 }
@@ -0,0 +1,32 @@
+package Speech2Text
+
+import (
+	"context"
+	"testing"
+)
+
+func TestListenForFile(t *testing.T) {
+	fileBuffer := make(chan []byte, 2)
+	stream := NewStream(context.Background(), fileBuffer, nil, nil, 4)
+	fileBuffer <- []byte{1, 2}
+	fileBuffer <- []byte{3, 4}
+
+	if !stream.listenForFile() {
+		t.Fatal("complete file reported as truncated")
+	}
+	if len(stream.uploadBuffer) != 4 {
+		t.Errorf("%d bytes received, want 4", len(stream.uploadBuffer))
+	}
+}
+
+// A websocket closed before the end of the file leaves it truncated
+func TestListenForFileClosed(t *testing.T) {
+	fileBuffer := make(chan []byte, 1)
+	stream := NewStream(context.Background(), fileBuffer, nil, nil, 4)
+	fileBuffer <- []byte{1, 2}
+	stream.Close()
+
+	if stream.listenForFile() {
+		t.Error("truncated file reported as complete")
+	}
+}
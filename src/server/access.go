@@ -0,0 +1,78 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"speech-to-text-back/src/server/account"
+	"strings"
+)
+
+// requestToken returns the token of the Authorization header, or of the
+// query parameter for websockets
+func requestToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) == 0 {
+		auth = r.URL.Query().Get("Authorization")
+	}
+	return strings.TrimPrefix(auth, "Bearer ")
+}
+
+// clientIp returns the address the request comes from, as given by the
+// proxy in front of the server when it is trusted
+func clientIp(h *Handler, r *http.Request) string {
+	if h.TrustProxy {
+		// The last address is the one the proxy saw, the ones before may
+		// have been sent by the client
+		if forwarded := r.Header.Get("X-Forwarded-For"); len(forwarded) > 0 {
+			addresses := strings.Split(forwarded, ",")
+			return strings.TrimSpace(addresses[len(addresses)-1])
+		}
+		if realIp := r.Header.Get("X-Real-IP"); len(realIp) > 0 {
+			return realIp
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// requestSession returns the session checked by RouteTree.ExecuteQuery, or
+// finds the one of the request token on routes that are not checked
+func requestSession(h *Handler, r *http.Request) (*account.Session, error) {
+	if session, ok := r.Context().Value(sessionKey).(*account.Session); ok {
+		return session, nil
+	}
+
+	return account.FindSession(h.MongoSession, requestToken(r))
+}
+
+// authorizeTranslation loads the translation translationId if the session
+// user has the required access to it, and answers the request otherwise
+func authorizeTranslation(h *Handler, w http.ResponseWriter, r *http.Request, translationId string, required string) (*account.Translation, *account.Session, bool) {
+	sess, err := requestSession(h, r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return nil, nil, false
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	t, err := account.AuthorizeTranslation(sessionCopy, translationId, sess.User, required)
+
+	if err == account.ErrForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return nil, nil, false
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	return t, sess, true
+}
@@ -0,0 +1,130 @@
+package account
+
+import (
+	"errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Access levels to a translation, each one including the ones before
+const (
+	AccessNone   = ""
+	AccessViewer = "viewer"
+	AccessEditor = "editor"
+	AccessOwner  = "owner"
+)
+
+var accessRanks = map[string]int{
+	AccessNone:   0,
+	AccessViewer: 1,
+	AccessEditor: 2,
+	AccessOwner:  3,
+}
+
+var ErrForbidden = errors.New("You do not have access to this translation")
+
+// Grant gives a user access to a translation
+type Grant struct {
+	User   bson.ObjectId `json:"user" bson:"user"`
+	Access string        `json:"access" bson:"access"`
+}
+
+func ValidAccess(access string) bool {
+	return access == AccessViewer || access == AccessEditor || access == AccessOwner
+}
+
+// AccessAllows tells whether access is at least required
+func AccessAllows(access string, required string) bool {
+	return accessRanks[access] >= accessRanks[required]
+}
+
+// AccessOf returns the access of user to t, the highest of their own and
+// of their role in the team of t
+func AccessOf(mongoSession *mgo.Session, t *Translation, user bson.ObjectId) (string, error) {
+	access, err := personalAccess(mongoSession, t, user)
+	if err != nil || len(t.Team) == 0 || access == AccessOwner {
+		return access, err
+	}
+
+	fromTeam, err := teamAccess(mongoSession, t.Team, user)
+	if err != nil {
+		return AccessNone, err
+	}
+	if AccessAllows(fromTeam, access) {
+		return fromTeam, nil
+	}
+	return access, nil
+}
+
+func personalAccess(mongoSession *mgo.Session, t *Translation, user bson.ObjectId) (string, error) {
+	if t.Owner == user {
+		return AccessOwner, nil
+	}
+	for _, grant := range t.Acl {
+		if grant.User == user {
+			return grant.Access, nil
+		}
+	}
+
+	return AccessNone, nil
+}
+
+// migrateTranslationOwners gives an owner to the translations created
+// before ownership was recorded: the oldest account that has them, the
+// other ones becoming editors
+func migrateTranslationOwners(mongoSession *mgo.Session) error {
+	translations := mongoSession.DB(Database).C("translations")
+	var legacy []Translation
+	err := translations.Find(bson.M{
+		"owner": bson.M{"$exists": false},
+	}).Select(bson.M{"_id": 1}).All(&legacy)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range legacy {
+		var holders []Account
+		err = mongoSession.DB(Database).C("accounts").Find(bson.M{
+			"translations": t.Id,
+		}).Select(bson.M{"_id": 1}).Sort("_id").All(&holders)
+		if err != nil {
+			return err
+		}
+		if len(holders) == 0 {
+			continue
+		}
+
+		acl := []Grant{{User: holders[0].Id, Access: AccessOwner}}
+		for _, holder := range holders[1:] {
+			acl = append(acl, Grant{User: holder.Id, Access: AccessEditor})
+		}
+		err = translations.UpdateId(t.Id, bson.M{
+			"$set": bson.M{"owner": holders[0].Id, "acl": acl},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AuthorizeTranslation loads a translation, failing with ErrForbidden when
+// user does not have the required access to it
+func AuthorizeTranslation(mongoSession *mgo.Session, translationId string, user bson.ObjectId, required string) (*Translation, error) {
+	t, err := findTranslation(mongoSession, translationId)
+	if err == mgo.ErrNotFound {
+		return nil, ErrForbidden
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	access, err := AccessOf(mongoSession, t, user)
+	if err != nil {
+		return nil, err
+	}
+	if !AccessAllows(access, required) {
+		return nil, ErrForbidden
+	}
+	return t, nil
+}
@@ -0,0 +1,181 @@
+package account
+
+import (
+	"errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"time"
+)
+
+// ApiKeyPrefix starts every API key, which tells them apart from session
+// tokens
+const ApiKeyPrefix = "s2t_"
+
+// Scopes an API key can be restricted to, a key without scope can do
+// everything its account can
+const (
+	ScopeRead   = "read"
+	ScopeWrite  = "write"
+	ScopeUpload = "upload"
+)
+
+var (
+	ErrInvalidApiKey = errors.New("Invalid or expired API key")
+	ErrApiKeyScope   = errors.New("The API key does not allow this request")
+	errInvalidScope  = errors.New("Invalid scope, expected read, write or upload")
+)
+
+// ApiKey authenticates scripts as an account. Its token is only stored hashed.
+type ApiKey struct {
+	Id        bson.ObjectId `json:"_id" bson:"_id,omitempty"`
+	TokenHash string        `json:"-" bson:"token_hash"`
+	// Prefix is the start of the token, to recognize keys in lists
+	Prefix    string        `json:"prefix" bson:"prefix"`
+	User      bson.ObjectId `json:"user" bson:"user"`
+	Label     string        `json:"label" bson:"label"`
+	Scopes    []string      `json:"scopes" bson:"scopes"`
+	CreatedAt time.Time     `json:"created_at" bson:"created_at"`
+	ExpiresAt *time.Time    `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	LastUsed  *time.Time    `json:"last_used,omitempty" bson:"last_used,omitempty"`
+}
+
+func ValidScope(scope string) bool {
+	switch scope {
+	case ScopeRead, ScopeWrite, ScopeUpload:
+		return true
+	}
+	return false
+}
+
+func IsApiKey(token string) bool {
+	return strings.HasPrefix(token, ApiKeyPrefix)
+}
+
+// Allows tells if the key can be used for a request needing scope
+func (k *ApiKey) Allows(scope string) bool {
+	if len(k.Scopes) == 0 {
+		return true
+	}
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func ensureApiKeyIndexes(mongoSession *mgo.Session) error {
+	return mongoSession.DB(Database).C("apikeys").EnsureIndex(mgo.Index{
+		Key:    []string{"token_hash"},
+		Unique: true,
+	})
+}
+
+// CreateApiKey returns the new key of user and its token, which cannot be
+// found again
+func CreateApiKey(mongoSession *mgo.Session, user bson.ObjectId, label string, scopes []string, expiresAt *time.Time) (*ApiKey, string, error) {
+	if len(label) == 0 {
+		return nil, "", &errorString{"Missing label"}
+	}
+	for _, scope := range scopes {
+		if !ValidScope(scope) {
+			return nil, "", errInvalidScope
+		}
+	}
+	if expiresAt != nil && expiresAt.Before(time.Now()) {
+		return nil, "", &errorString{"The expiry date of a key must be in the future"}
+	}
+
+	random, err := RandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	token := ApiKeyPrefix + random
+
+	if scopes == nil {
+		scopes = make([]string, 0)
+	}
+
+	key := ApiKey{
+		Id:        bson.NewObjectId(),
+		TokenHash: HashToken(token),
+		Prefix:    token[:len(ApiKeyPrefix)+6],
+		User:      user,
+		Label:     label,
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+
+	err = mongoSession.DB(Database).C("apikeys").Insert(&key)
+	if err != nil {
+		return nil, "", err
+	}
+	return &key, token, nil
+}
+
+func ListApiKeys(mongoSession *mgo.Session, user bson.ObjectId) (keys []ApiKey, err error) {
+	keys = make([]ApiKey, 0)
+	err = mongoSession.DB(Database).C("apikeys").Find(bson.M{
+		"user": user,
+	}).Sort("-created_at").All(&keys)
+	return keys, err
+}
+
+// RevokeApiKey deletes a key of user
+func RevokeApiKey(mongoSession *mgo.Session, user bson.ObjectId, keyId string) error {
+	if !bson.IsObjectIdHex(keyId) {
+		return &errorString{"Invalid key id"}
+	}
+	return mongoSession.DB(Database).C("apikeys").Remove(bson.M{
+		"_id":  bson.ObjectIdHex(keyId),
+		"user": user,
+	})
+}
+
+// CheckApiKey returns the key of token if it is valid and its account
+// enabled, recording that it was used
+func CheckApiKey(token string, mongoSession *mgo.Session) (*ApiKey, error) {
+	sessionCopy := mongoSession.Copy()
+	defer sessionCopy.Close()
+	collection := sessionCopy.DB(Database).C("apikeys")
+
+	var key ApiKey
+	err := collection.Find(bson.M{"token_hash": HashToken(token)}).One(&key)
+	if err == mgo.ErrNotFound {
+		return nil, ErrInvalidApiKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if key.ExpiresAt != nil && key.ExpiresAt.Before(now) {
+		return nil, ErrInvalidApiKey
+	}
+
+	a, err := FindAccount(sessionCopy, key.User)
+	if err != nil {
+		return nil, ErrInvalidApiKey
+	}
+	if a.Disabled {
+		return nil, ErrAccountDisabled
+	}
+
+	if key.LastUsed == nil || now.Sub(*key.LastUsed) >= touchInterval {
+		key.LastUsed = &now
+		err = collection.UpdateId(key.Id, bson.M{
+			"$set": bson.M{"last_used": now},
+		})
+	}
+	return &key, err
+}
+
+// Session is how the rest of the server sees a request made with the key
+func (k *ApiKey) Session() *Session {
+	return &Session{
+		User:   k.User,
+		ApiKey: k.Id,
+	}
+}
@@ -0,0 +1,311 @@
+package account
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"time"
+)
+
+var (
+	// LoginMaxAttempts failures in a row lock an account name
+	LoginMaxAttempts = 10
+	// LoginMaxIpAttempts failures in a row lock an address
+	LoginMaxIpAttempts = 50
+	// LoginLockout is how long a lock lasts, and the longest backoff
+	LoginLockout = 15 * time.Minute
+)
+
+// Failures allowed before logins are slowed down
+const loginFreeAttempts = 3
+
+// First delay between attempts once logins are slowed down, it doubles
+// after every failure
+const loginBackoff = time.Second
+
+// ThrottleError refuses a login until Until
+type ThrottleError struct {
+	Until time.Time
+}
+
+func (e *ThrottleError) Error() string {
+	return fmt.Sprintf("Too many failed logins, try again in %d seconds", e.RetryAfter())
+}
+
+// RetryAfter is the number of seconds to wait, at least 1
+func (e *ThrottleError) RetryAfter() int {
+	seconds := int(time.Until(e.Until).Seconds()) + 1
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
+
+// loginAttempts counts the failed logins in a row of an account name or
+// of an address
+type loginAttempts struct {
+	Id          string    `bson:"_id"`
+	Failures    int       `bson:"failures"`
+	LastFailure time.Time `bson:"last_failure"`
+	LockedUntil time.Time `bson:"locked_until"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
+
+func accountAttemptsKey(name string) string {
+	return "account:" + name
+}
+
+func ipAttemptsKey(ip string) string {
+	return "ip:" + ip
+}
+
+func linkAttemptsKey(link bson.ObjectId) string {
+	return "link:" + link.Hex()
+}
+
+func resetAttemptsKey(identifier string) string {
+	return "reset:" + identifier
+}
+
+func resetIpAttemptsKey(ip string) string {
+	return "reset-ip:" + ip
+}
+
+func ensureAttemptIndexes(mongoSession *mgo.Session) error {
+	return mongoSession.DB(Database).C("login_attempts").EnsureIndex(mgo.Index{
+		Key:         []string{"expires_at"},
+		ExpireAfter: time.Second,
+	})
+}
+
+// lockedUntil returns when the next attempt is allowed after failures
+func lockedUntil(failures int, maxAttempts int, last time.Time) time.Time {
+	if failures >= maxAttempts {
+		return last.Add(LoginLockout)
+	}
+	if failures <= loginFreeAttempts {
+		return last
+	}
+	delay := loginBackoff << uint(failures-loginFreeAttempts-1)
+	if delay > LoginLockout || delay <= 0 {
+		delay = LoginLockout
+	}
+	return last.Add(delay)
+}
+
+// LoginAttempt is a login counted as failed from its start, so that
+// parallel attempts cannot all pass the throttle before any failure is
+// recorded. It is settled by RecordLoginFailure or CancelLoginAttempt.
+type LoginAttempt struct {
+	Name          string
+	Ip            string
+	accountLocked bool
+	ipLocked      bool
+}
+
+// BeginLoginAttempt counts a login of name from ip as failed, or returns a
+// *ThrottleError when name or ip failed too often recently. It is called
+// before checking any password, so that throttled logins cost no hashing.
+func BeginLoginAttempt(mongoSession *mgo.Session, name string, ip string) (*LoginAttempt, error) {
+	now := time.Now()
+	attempt := &LoginAttempt{Name: name, Ip: ip}
+
+	locked, err := reserveAttempt(mongoSession, accountAttemptsKey(name), LoginMaxAttempts, now)
+	if err != nil {
+		return nil, err
+	}
+	attempt.accountLocked = locked
+
+	locked, err = reserveAttempt(mongoSession, ipAttemptsKey(ip), LoginMaxIpAttempts, now)
+	if err != nil {
+		if refundErr := refundAttempt(mongoSession, accountAttemptsKey(name), LoginMaxAttempts); refundErr != nil {
+			return nil, refundErr
+		}
+		return nil, err
+	}
+	attempt.ipLocked = locked
+	return attempt, nil
+}
+
+// CancelLoginAttempt takes back the failure counted by BeginLoginAttempt,
+// once the password proved right
+func CancelLoginAttempt(mongoSession *mgo.Session, attempt *LoginAttempt) error {
+	if err := refundAttempt(mongoSession, accountAttemptsKey(attempt.Name), LoginMaxAttempts); err != nil {
+		return err
+	}
+	return refundAttempt(mongoSession, ipAttemptsKey(attempt.Ip), LoginMaxIpAttempts)
+}
+
+// reserveAttempt counts a failure on key unless it is locked, and returns
+// whether it reached maxAttempts. The lock is checked in the filter of the
+// update counting the failure, a concurrent attempt making it match nothing
+// and be tried again.
+func reserveAttempt(mongoSession *mgo.Session, key string, maxAttempts int, now time.Time) (bool, error) {
+	collection := mongoSession.DB(Database).C("login_attempts")
+
+	for {
+		var a loginAttempts
+		err := collection.FindId(key).One(&a)
+		found := err == nil
+		if err != nil && err != mgo.ErrNotFound {
+			return false, err
+		}
+		if a.LockedUntil.After(now) {
+			return false, &ThrottleError{Until: a.LockedUntil}
+		}
+
+		failures := a.Failures + 1
+		until := lockedUntil(failures, maxAttempts, now)
+		// Counters are forgotten once nothing failed for a lockout period
+		expires := until
+		if expires.Before(now.Add(LoginLockout)) {
+			expires = now.Add(LoginLockout)
+		}
+		counted := loginAttempts{
+			Id:          key,
+			Failures:    failures,
+			LastFailure: now,
+			LockedUntil: until,
+			ExpiresAt:   expires,
+		}
+
+		if found {
+			err = collection.Update(bson.M{
+				"_id":          key,
+				"failures":     a.Failures,
+				"locked_until": bson.M{"$lte": now},
+			}, counted)
+		} else {
+			err = collection.Insert(counted)
+		}
+		if err == mgo.ErrNotFound || mgo.IsDup(err) {
+			continue
+		}
+		return failures == maxAttempts, err
+	}
+}
+
+// refundAttempt takes back a failure counted on key by reserveAttempt
+func refundAttempt(mongoSession *mgo.Session, key string, maxAttempts int) error {
+	collection := mongoSession.DB(Database).C("login_attempts")
+
+	for {
+		var a loginAttempts
+		err := collection.FindId(key).One(&a)
+		if err == mgo.ErrNotFound || (err == nil && a.Failures <= 0) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = collection.Update(bson.M{"_id": key, "failures": a.Failures}, bson.M{
+			"$set": bson.M{
+				"failures":     a.Failures - 1,
+				"locked_until": lockedUntil(a.Failures-1, maxAttempts, a.LastFailure),
+			},
+		})
+		if err != mgo.ErrNotFound {
+			return err
+		}
+	}
+}
+
+// CountPasswordResetRequest returns a *ThrottleError when resets of
+// identifier or from ip were requested too often recently. Every request
+// counts as a failure, none of them proving anything.
+func CountPasswordResetRequest(mongoSession *mgo.Session, identifier string, ip string) error {
+	now := time.Now()
+	if _, err := reserveAttempt(mongoSession, resetAttemptsKey(identifier), LoginMaxAttempts, now); err != nil {
+		return err
+	}
+	_, err := reserveAttempt(mongoSession, resetIpAttemptsKey(ip), LoginMaxIpAttempts, now)
+	return err
+}
+
+// RecordLoginFailure audits the failure counted by attempt, along with the
+// locks it causes
+func RecordLoginFailure(mongoSession *mgo.Session, attempt *LoginAttempt, userAgent string, reason error) error {
+	event := AuditEvent{
+		Type:      AuditLoginFailed,
+		Name:      attempt.Name,
+		Ip:        attempt.Ip,
+		UserAgent: userAgent,
+		Reason:    reason.Error(),
+	}
+	var a Account
+	if mongoSession.DB(Database).C("accounts").Find(bson.M{"name": attempt.Name}).One(&a) == nil {
+		event.Account = a.Id
+	}
+	Audit(mongoSession, event)
+
+	if attempt.accountLocked {
+		event.Type = AuditLoginLocked
+		event.Reason = "account"
+		Audit(mongoSession, event)
+	}
+	if attempt.ipLocked {
+		event.Type = AuditLoginLocked
+		event.Reason = "ip"
+		Audit(mongoSession, event)
+	}
+	return nil
+}
+
+// RecordLoginSuccess forgets the failures of name. Those of the address
+// are kept, a valid account must not clear the attempts on other ones.
+func RecordLoginSuccess(mongoSession *mgo.Session, name string) error {
+	err := mongoSession.DB(Database).C("login_attempts").RemoveId(accountAttemptsKey(name))
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// ErrInvalidCredentials is the answer to every failed or throttled login,
+// which must not tell whether the account exists
+var ErrInvalidCredentials = errors.New("Invalid credentials")
+
+// IsCredentialError tells if err from IdentifyAccount means wrong
+// credentials, rather than a failure of the server or directory
+func IsCredentialError(err error) bool {
+	return err == bcrypt.ErrMismatchedHashAndPassword ||
+		err == bcrypt.ErrHashTooShort ||
+		err == mgo.ErrNotFound ||
+		err == ErrLdapCredentials
+}
+
+// UnlockLogin clears the failed logins of the account userId, and of ip
+// when it is set
+func UnlockLogin(mongoSession *mgo.Session, admin bson.ObjectId, userId string, ip string) error {
+	user, err := parseAccountId(userId)
+	if err != nil {
+		return err
+	}
+	a, err := FindAccount(mongoSession, user)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{accountAttemptsKey(a.Name)}
+	if len(ip) > 0 {
+		keys = append(keys, ipAttemptsKey(ip))
+	}
+	_, err = mongoSession.DB(Database).C("login_attempts").RemoveAll(bson.M{
+		"_id": bson.M{"$in": keys},
+	})
+	if err != nil {
+		return err
+	}
+
+	Audit(mongoSession, AuditEvent{
+		Type:    AuditAccountUnlock,
+		Account: a.Id,
+		Name:    a.Name,
+		Ip:      ip,
+		Actor:   admin,
+	})
+	return nil
+}
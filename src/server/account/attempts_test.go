@@ -0,0 +1,80 @@
+package account
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockedUntil(t *testing.T) {
+	last := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{loginFreeAttempts, 0},
+		{loginFreeAttempts + 1, loginBackoff},
+		{loginFreeAttempts + 3, 4 * loginBackoff},
+		{9, 32 * loginBackoff},
+		{10, LoginLockout},
+		{60, LoginLockout},
+	}
+	for _, test := range tests {
+		if got := lockedUntil(test.failures, 10, last).Sub(last); got != test.want {
+			t.Errorf("lockedUntil(%d) waits %v, want %v", test.failures, got, test.want)
+		}
+	}
+}
+
+// A burst of parallel attempts must not pass the throttle before their
+// failures are counted
+func TestBeginLoginAttemptBurst(t *testing.T) {
+	session := testMongo(t)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := session.Copy()
+			defer s.Close()
+			if _, err := BeginLoginAttempt(s, "burst", "192.0.2.1"); err == nil {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			} else if _, ok := err.(*ThrottleError); !ok {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != loginFreeAttempts+1 {
+		t.Errorf("%d attempts allowed, want %d", allowed, loginFreeAttempts+1)
+	}
+}
+
+func TestCancelLoginAttempt(t *testing.T) {
+	session := testMongo(t)
+
+	for i := 0; i < loginFreeAttempts+1; i++ {
+		attempt, err := BeginLoginAttempt(session, "cancel", "192.0.2.2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = CancelLoginAttempt(session, attempt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var a loginAttempts
+	if err := session.DB(Database).C("login_attempts").FindId(accountAttemptsKey("cancel")).One(&a); err != nil {
+		t.Fatal(err)
+	}
+	if a.Failures != 0 {
+		t.Errorf("%d failures left after cancelled attempts", a.Failures)
+	}
+}
@@ -0,0 +1,57 @@
+package account
+
+import (
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"log"
+	"time"
+)
+
+// Types of audit events
+const (
+	AuditLoginFailed   = "login_failed"
+	AuditLoginLocked   = "login_locked"
+	AuditAccountUnlock = "account_unlocked"
+)
+
+// AuditEvent records a security relevant event
+type AuditEvent struct {
+	Id   bson.ObjectId `json:"_id" bson:"_id,omitempty"`
+	Type string        `json:"type" bson:"type"`
+	// Account the event is about, when it exists
+	Account bson.ObjectId `json:"account,omitempty" bson:"account,omitempty"`
+	// Name given at login, which may not be an account
+	Name      string        `json:"name,omitempty" bson:"name,omitempty"`
+	Ip        string        `json:"ip,omitempty" bson:"ip,omitempty"`
+	UserAgent string        `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	Reason    string        `json:"reason,omitempty" bson:"reason,omitempty"`
+	Actor     bson.ObjectId `json:"actor,omitempty" bson:"actor,omitempty"`
+	At        time.Time     `json:"at" bson:"at"`
+}
+
+func ensureAuditIndexes(mongoSession *mgo.Session) error {
+	return mongoSession.DB(Database).C("audit").EnsureIndex(mgo.Index{
+		Key: []string{"-at"},
+	})
+}
+
+// Audit saves event, failures are only logged so that they never block
+// what is audited
+func Audit(mongoSession *mgo.Session, event AuditEvent) {
+	event.Id = bson.NewObjectId()
+	event.At = time.Now()
+	if err := mongoSession.DB(Database).C("audit").Insert(&event); err != nil {
+		log.Printf("audit %s: %s", event.Type, err)
+	}
+}
+
+// ListAudit returns the latest events, of type when it is set
+func ListAudit(mongoSession *mgo.Session, eventType string, limit int) (events []AuditEvent, err error) {
+	query := bson.M{}
+	if len(eventType) > 0 {
+		query["type"] = eventType
+	}
+	events = make([]AuditEvent, 0)
+	err = mongoSession.DB(Database).C("audit").Find(query).Sort("-at").Limit(limit).All(&events)
+	return events, err
+}
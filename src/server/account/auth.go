@@ -4,15 +4,48 @@ import (
 	"golang.org/x/crypto/bcrypt"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
-	"time"
+	"net/mail"
 )
 
+var errInvalidEmail = &errorString{"Invalid email address"}
+
+// passwordCost is the bcrypt cost of every account password hash
+const passwordCost = 14
+
+// unknownAccountHash is compared to the passwords of unknown accounts, so
+// that they take as long to refuse as wrong passwords
+var unknownAccountHash, _ = bcrypt.GenerateFromPassword([]byte("unknown account"), passwordCost)
+
+func validEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email
+}
+
 func CreateAccount(account *Account, mongoSession *mgo.Session) error {
 	sessionCopy := mongoSession.Copy()
 	defer sessionCopy.Close()
-	collection := sessionCopy.DB("s2t").C("accounts")
+	collection := sessionCopy.DB(Database).C("accounts")
+
+	if len(account.Name) == 0 || len(account.Password) == 0 {
+		return &errorString{"Missing name or password"}
+	}
 
-	bytesHash, err := bcrypt.GenerateFromPassword([]byte(account.Password), 14)
+	account.Source = ""
+	account.Oidc = nil
+
+	if len(account.Role) == 0 {
+		account.Role = RoleMember
+	}
+
+	if !ValidRole(account.Role) {
+		return errInvalidRole
+	}
+
+	if len(account.Email) > 0 && !validEmail(account.Email) {
+		return errInvalidEmail
+	}
+
+	bytesHash, err := bcrypt.GenerateFromPassword([]byte(account.Password), passwordCost)
 
 	if err != nil {
 		return err
@@ -20,15 +53,30 @@ func CreateAccount(account *Account, mongoSession *mgo.Session) error {
 
 	account.Password = string(bytesHash)
 
-	return collection.Insert(&account)
+	// New accounts have nothing besides what they are created with
+	account.Translations = make([]bson.ObjectId, 0)
+	account.TotpEnabled = false
+
+	err = collection.Insert(&account)
+	if mgo.IsDup(err) {
+		return ErrNameTaken
+	}
+	return err
 }
 
 func IdentifyAccount(queriedAccount *Account, mongoSession *mgo.Session) (*bson.ObjectId, error) {
 	sessionCopy := mongoSession.Copy()
 	defer sessionCopy.Close()
-	collection := sessionCopy.DB("s2t").C("accounts")
+	collection := sessionCopy.DB(Database).C("accounts")
 	var dbAccount *Account
 	err := collection.Find(bson.M{"name": queriedAccount.Name}).One(&dbAccount)
+	if err == mgo.ErrNotFound && Ldap != nil {
+		return identifyLdapAccount(sessionCopy, queriedAccount.Name, queriedAccount.Password)
+	}
+	if err == mgo.ErrNotFound {
+		_ = bcrypt.CompareHashAndPassword(unknownAccountHash, []byte(queriedAccount.Password))
+		return nil, err
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -37,37 +85,51 @@ func IdentifyAccount(queriedAccount *Account, mongoSession *mgo.Session) (*bson.
 		return nil, nil
 	}
 
+	if dbAccount.Source == SourceLdap {
+		if Ldap == nil {
+			return nil, ErrLdapCredentials
+		}
+		return identifyLdapAccount(sessionCopy, queriedAccount.Name, queriedAccount.Password)
+	}
+
 	comparison := bcrypt.CompareHashAndPassword([]byte(dbAccount.Password), []byte(queriedAccount.Password))
 
 	if comparison != nil {
 		return nil, comparison
 	}
 
-	return &dbAccount.Id, nil
-}
-
-func CreateSession(id bson.ObjectId, sessionCopy *mgo.Session) (*Session, error) {
-	collection := sessionCopy.DB("s2t").C("sessions")
-
-	session := Session{
-		User:      id,
-		CreatedAt: time.Now(),
+	if dbAccount.Disabled {
+		return nil, ErrAccountDisabled
 	}
 
-	err := collection.Insert(&session)
+	return &dbAccount.Id, nil
+}
 
+// SetEmail changes the address password reset links are sent to after
+// checking the current password, an empty one removing it
+func SetEmail(mongoSession *mgo.Session, user bson.ObjectId, current string, email string) error {
+	a, err := FindAccount(mongoSession, user)
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	var createdSession Session
-	err = collection.Find(&session).One(&createdSession)
-
-	if err != nil {
-		return nil, err
+	if len(a.Source) > 0 {
+		return errLocalPasswordOnly
+	}
+	if bcrypt.CompareHashAndPassword([]byte(a.Password), []byte(current)) != nil {
+		return ErrWrongPassword
 	}
 
-	return &createdSession, nil
+	if len(email) == 0 {
+		return mongoSession.DB(Database).C("accounts").UpdateId(user, bson.M{
+			"$unset": bson.M{"email": ""},
+		})
+	}
+	if !validEmail(email) {
+		return errInvalidEmail
+	}
+	return mongoSession.DB(Database).C("accounts").UpdateId(user, bson.M{
+		"$set": bson.M{"email": email},
+	})
 }
 
 type errorString struct {
@@ -77,28 +139,3 @@ type errorString struct {
 func (e *errorString) Error() string {
 	return e.s
 }
-
-func CheckSession(sessionId string, mongoSession *mgo.Session) (bool, error) {
-	sessionCopy := mongoSession.Copy()
-	defer sessionCopy.Close()
-	collection := sessionCopy.DB("s2t").C("sessions")
-
-	if len(sessionId) < 12 {
-		return false, &errorString{"Invalid sessionID"}
-	}
-	oid := bson.ObjectIdHex(sessionId)
-
-	var session *Session
-	err := collection.Find(bson.M{"_id": oid}).One(&session)
-
-	if err != nil {
-		return false, err
-	}
-
-	if session == nil {
-		return false, nil
-	}
-
-	oneDay := 24 * time.Hour
-	return session.CreatedAt.Add(oneDay).Sub(time.Now()) > 0, nil
-}
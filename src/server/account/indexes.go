@@ -0,0 +1,37 @@
+package account
+
+import (
+	"gopkg.in/mgo.v2"
+)
+
+// Database is the MongoDB database the server uses
+var Database = "s2t"
+
+// EnsureIndexes creates the indexes the queries rely on, and migrates the
+// documents that would prevent them from being built
+func EnsureIndexes(mongoSession *mgo.Session) error {
+	sessionCopy := mongoSession.Copy()
+	defer sessionCopy.Close()
+
+	ensures := []func(*mgo.Session) error{
+		migrateTranslationOwners,
+		ensureSearchIndexes,
+		ensureAccountIndexes,
+		ensureSessionIndexes,
+		ensureLinkIndexes,
+		ensureApiKeyIndexes,
+		ensureOidcIndexes,
+		ensureAttemptIndexes,
+		ensureAuditIndexes,
+		ensureMfaIndexes,
+		ensurePasswordResetIndexes,
+		ensureTeamIndexes,
+		ensureProjectIndexes,
+	}
+	for _, ensure := range ensures {
+		if err := ensure(sessionCopy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
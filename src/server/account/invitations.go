@@ -0,0 +1,223 @@
+package account
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"log"
+	"strings"
+	"time"
+)
+
+const AuditRegistered = "registered"
+
+var (
+	// InvitationUrl is the front-end registration page, the code being
+	// added as its code parameter
+	InvitationUrl string
+	// Lifetime of an invitation created without expiry
+	DefaultInvitationLifetime = 7 * 24 * time.Hour
+)
+
+var (
+	ErrNameTaken         = errors.New("An account with this name already exists")
+	ErrInvalidInvitation = errors.New("Invalid, expired or used up invitation")
+	errInvitationEmail   = errors.New("This invitation is for another email address")
+)
+
+// Invitation lets people register an account with its code, which is only
+// stored hashed
+type Invitation struct {
+	Id       bson.ObjectId `json:"_id" bson:"_id,omitempty"`
+	CodeHash string        `json:"-" bson:"code_hash"`
+	// Email restricts the invitation to one address, which receives the
+	// code, when set
+	Email string `json:"email,omitempty" bson:"email,omitempty"`
+	Role  string `json:"role" bson:"role"`
+	// Team the new accounts join with TeamRole, when set
+	Team      bson.ObjectId   `json:"team,omitempty" bson:"team,omitempty"`
+	TeamRole  string          `json:"team_role,omitempty" bson:"team_role,omitempty"`
+	MaxUses   int             `json:"max_uses" bson:"max_uses"`
+	Uses      int             `json:"uses" bson:"uses"`
+	UsedBy    []bson.ObjectId `json:"used_by" bson:"used_by"`
+	CreatedBy bson.ObjectId   `json:"created_by" bson:"created_by"`
+	CreatedAt time.Time       `json:"created_at" bson:"created_at"`
+	ExpiresAt time.Time       `json:"expires_at" bson:"expires_at"`
+	Revoked   bool            `json:"revoked" bson:"revoked"`
+}
+
+func ensureAccountIndexes(mongoSession *mgo.Session) error {
+	err := mongoSession.DB(Database).C("accounts").EnsureIndex(mgo.Index{
+		Key:    []string{"name"},
+		Unique: true,
+	})
+	if mgo.IsDup(err) {
+		return fmt.Errorf("several accounts have the same name, rename them before starting the server: %s", err)
+	}
+	if err != nil {
+		return err
+	}
+	return mongoSession.DB(Database).C("invitations").EnsureIndex(mgo.Index{
+		Key:    []string{"code_hash"},
+		Unique: true,
+	})
+}
+
+// CreateInvitation returns a new invitation and its code, which cannot be
+// found again. The code is also sent to the email of the invitation, which
+// is removed when it cannot be.
+func CreateInvitation(mongoSession *mgo.Session, notifier Notifier, admin bson.ObjectId, inv Invitation) (*Invitation, string, error) {
+	if len(inv.Role) == 0 {
+		inv.Role = RoleMember
+	}
+	if !ValidRole(inv.Role) {
+		return nil, "", errInvalidRole
+	}
+	if len(inv.Email) > 0 && !validEmail(inv.Email) {
+		return nil, "", errInvalidEmail
+	}
+	if inv.MaxUses == 0 {
+		inv.MaxUses = 1
+	}
+	if inv.MaxUses < 0 {
+		return nil, "", &errorString{"The number of uses must be positive"}
+	}
+	if len(inv.Team) > 0 {
+		if _, err := FindTeam(mongoSession, inv.Team.Hex()); err != nil {
+			return nil, "", err
+		}
+		if len(inv.TeamRole) == 0 {
+			inv.TeamRole = TeamRoleEditor
+		}
+		if !ValidTeamRole(inv.TeamRole) {
+			return nil, "", errTeamRole
+		}
+	} else {
+		inv.TeamRole = ""
+	}
+	if inv.ExpiresAt.IsZero() {
+		inv.ExpiresAt = time.Now().Add(DefaultInvitationLifetime)
+	}
+	if inv.ExpiresAt.Before(time.Now()) {
+		return nil, "", &errorString{"The expiry date of an invitation must be in the future"}
+	}
+
+	code, err := RandomToken(24)
+	if err != nil {
+		return nil, "", err
+	}
+
+	inv.Id = bson.NewObjectId()
+	inv.CodeHash = HashToken(code)
+	inv.Uses = 0
+	inv.UsedBy = make([]bson.ObjectId, 0)
+	inv.CreatedBy = admin
+	inv.CreatedAt = time.Now()
+	inv.Revoked = false
+
+	if err = mongoSession.DB(Database).C("invitations").Insert(&inv); err != nil {
+		return nil, "", err
+	}
+
+	if len(inv.Email) > 0 {
+		link := code
+		if len(InvitationUrl) > 0 {
+			link = InvitationUrl + "?code=" + code
+		}
+		body := fmt.Sprintf("You are invited to create an account on the speech to text server.\n\nRegister before %s with:\n%s\n",
+			inv.ExpiresAt.Format(time.RFC1123), link)
+		if err = notifier.Send(inv.Email, "Invitation", body); err != nil {
+			if removeErr := mongoSession.DB(Database).C("invitations").RemoveId(inv.Id); removeErr != nil {
+				log.Println(removeErr)
+			}
+			return nil, "", err
+		}
+	}
+	return &inv, code, nil
+}
+
+func ListInvitations(mongoSession *mgo.Session) (invitations []Invitation, err error) {
+	invitations = make([]Invitation, 0)
+	err = mongoSession.DB(Database).C("invitations").Find(nil).Sort("-created_at").All(&invitations)
+	return invitations, err
+}
+
+func RevokeInvitation(mongoSession *mgo.Session, invitationId string) error {
+	if !bson.IsObjectIdHex(invitationId) {
+		return &errorString{"Invalid invitation id"}
+	}
+	return mongoSession.DB(Database).C("invitations").UpdateId(bson.ObjectIdHex(invitationId), bson.M{
+		"$set": bson.M{"revoked": true},
+	})
+}
+
+// Register creates an account with the role of the invitation of code,
+// using one of its uses
+func Register(mongoSession *mgo.Session, code string, a *Account) error {
+	collection := mongoSession.DB(Database).C("invitations")
+
+	var inv Invitation
+	err := collection.Find(bson.M{"code_hash": HashToken(code)}).One(&inv)
+	if err == mgo.ErrNotFound {
+		return ErrInvalidInvitation
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(inv.Email) > 0 {
+		if len(a.Email) == 0 {
+			a.Email = inv.Email
+		}
+		if !strings.EqualFold(a.Email, inv.Email) {
+			return errInvitationEmail
+		}
+	}
+
+	// The use is taken first so that concurrent registrations cannot
+	// exceed the uses of the invitation
+	err = collection.Update(bson.M{
+		"_id":        inv.Id,
+		"revoked":    false,
+		"expires_at": bson.M{"$gt": time.Now()},
+		"uses":       bson.M{"$lt": inv.MaxUses},
+	}, bson.M{
+		"$inc": bson.M{"uses": 1},
+	})
+	if err == mgo.ErrNotFound {
+		return ErrInvalidInvitation
+	}
+	if err != nil {
+		return err
+	}
+
+	a.Id = bson.NewObjectId()
+	a.Role = inv.Role
+	a.Disabled = false
+	err = CreateAccount(a, mongoSession)
+	if err != nil {
+		if undoErr := collection.UpdateId(inv.Id, bson.M{"$inc": bson.M{"uses": -1}}); undoErr != nil {
+			return undoErr
+		}
+		return err
+	}
+
+	Audit(mongoSession, AuditEvent{Type: AuditRegistered, Account: a.Id, Name: a.Name, Actor: inv.CreatedBy})
+
+	// The account exists by now, so a team deleted since the invitation
+	// does not fail the registration
+	if len(inv.Team) > 0 {
+		team, err := FindTeam(mongoSession, inv.Team.Hex())
+		if err == nil {
+			err = AddTeamMember(mongoSession, team, a.Id.Hex(), inv.TeamRole)
+		}
+		if err != nil {
+			log.Printf("adding %s to team %s: %s", a.Name, inv.Team.Hex(), err)
+		}
+	}
+
+	return collection.UpdateId(inv.Id, bson.M{
+		"$push": bson.M{"used_by": a.Id},
+	})
+}
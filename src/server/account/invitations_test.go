@@ -0,0 +1,144 @@
+package account
+
+import (
+	"errors"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+	"time"
+)
+
+type sentMessage struct {
+	to, subject, body string
+}
+
+type recordingNotifier struct {
+	sent []sentMessage
+}
+
+func (n *recordingNotifier) Send(to string, subject string, body string) error {
+	n.sent = append(n.sent, sentMessage{to, subject, body})
+	return nil
+}
+
+type failingNotifier struct{}
+
+func (failingNotifier) Send(to string, subject string, body string) error {
+	return errors.New("mail server down")
+}
+
+// An invitation whose code could not be sent is not kept
+func TestCreateInvitationSendFailure(t *testing.T) {
+	mongoSession := testMongo(t)
+
+	_, _, err := CreateInvitation(mongoSession, failingNotifier{}, bson.NewObjectId(), Invitation{Email: "invited@example.com"})
+	if err == nil {
+		t.Fatal("the failed send was not reported")
+	}
+	count, err := mongoSession.DB(Database).C("invitations").Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("%d invitations kept", count)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	mongoSession := testMongo(t)
+	admin := bson.NewObjectId()
+
+	tests := []struct {
+		name string
+		// Invitation made for the test and changes made to it once created
+		invitation Invitation
+		prepare    func(t *testing.T, inv *Invitation)
+		email      string
+		// Errors of two registrations in a row with the code
+		want []error
+	}{
+		{
+			name:       "single use",
+			invitation: Invitation{},
+			want:       []error{nil, ErrInvalidInvitation},
+		},
+		{
+			name:       "several uses",
+			invitation: Invitation{MaxUses: 2, Role: RoleGuest},
+			want:       []error{nil, nil},
+		},
+		{
+			name:       "revoked",
+			invitation: Invitation{},
+			prepare: func(t *testing.T, inv *Invitation) {
+				if err := RevokeInvitation(mongoSession, inv.Id.Hex()); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []error{ErrInvalidInvitation, ErrInvalidInvitation},
+		},
+		{
+			name:       "expired",
+			invitation: Invitation{},
+			prepare: func(t *testing.T, inv *Invitation) {
+				err := mongoSession.DB(Database).C("invitations").UpdateId(inv.Id, bson.M{
+					"$set": bson.M{"expires_at": time.Now().Add(-time.Minute)},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []error{ErrInvalidInvitation, ErrInvalidInvitation},
+		},
+		{
+			name:       "other email",
+			invitation: Invitation{Email: "invited@example.org"},
+			email:      "someone@example.org",
+			want:       []error{errInvitationEmail, errInvitationEmail},
+		},
+		{
+			name:       "invited email",
+			invitation: Invitation{Email: "invited@example.org"},
+			want:       []error{nil, ErrInvalidInvitation},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			notifier := &recordingNotifier{}
+			inv, code, err := CreateInvitation(mongoSession, notifier, admin, test.invitation)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(inv.Email) > 0 && (len(notifier.sent) != 1 || notifier.sent[0].to != inv.Email) {
+				t.Errorf("the code was not sent to %s: %v", inv.Email, notifier.sent)
+			}
+			if test.prepare != nil {
+				test.prepare(t, inv)
+			}
+
+			for i, want := range test.want {
+				a := Account{
+					Name:     "register-" + bson.NewObjectId().Hex(),
+					Password: "password",
+					Email:    test.email,
+					Role:     RoleAdmin,
+				}
+				err := Register(mongoSession, code, &a)
+				if err != want {
+					t.Fatalf("registration %d: got %v, want %v", i+1, err, want)
+				}
+				if err != nil {
+					continue
+				}
+
+				created, err := FindAccount(mongoSession, a.Id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if created.Role != inv.Role {
+					t.Errorf("registered as %s, want the role of the invitation %s", created.Role, inv.Role)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package account
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"os"
+	"strings"
+)
+
+// SourceLdap marks the accounts authenticated by the directory
+const SourceLdap = "ldap"
+
+var ErrLdapCredentials = errors.New("Invalid directory name or password")
+
+// Ldap authenticates the accounts of the directory when it is configured
+var Ldap *LdapProvider
+
+// LdapProvider binds against a directory to check passwords and reads the
+// groups of its users
+type LdapProvider struct {
+	Url          string
+	StartTLS     bool
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// UserFilter finds a user, %s being replaced by the escaped login name
+	UserFilter string
+	// NameAttribute of user entries is their canonical login name, which
+	// names their account whatever the case the user typed
+	NameAttribute string
+	// GroupAttribute of user entries lists their groups, memberOf for
+	// OpenLDAP and Active Directory
+	GroupAttribute string
+	// GroupFilter, when set, searches the groups of a user under
+	// GroupBaseDN instead, %s being replaced by the escaped user DN
+	GroupFilter string
+	GroupBaseDN string
+	// Groups whose members get each role, by DN or common name
+	AdminGroups  []string
+	MemberGroups []string
+	// DefaultRole of users in none of the groups, no role refusing them
+	DefaultRole string
+}
+
+// LdapUser is a directory entry that logged in
+type LdapUser struct {
+	DN     string
+	Name   string
+	Groups []string
+}
+
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ";") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// NewLdapProvider reads the LDAP_* environment variables, it returns nil
+// when LDAP_URL is not set
+func NewLdapProvider() (*LdapProvider, error) {
+	url := os.Getenv("LDAP_URL")
+	if len(url) == 0 {
+		return nil, nil
+	}
+
+	p := &LdapProvider{
+		Url:            url,
+		StartTLS:       os.Getenv("LDAP_START_TLS") == "true",
+		BindDN:         os.Getenv("LDAP_BIND_DN"),
+		BindPassword:   os.Getenv("LDAP_BIND_PASSWORD"),
+		BaseDN:         os.Getenv("LDAP_BASE_DN"),
+		UserFilter:     os.Getenv("LDAP_USER_FILTER"),
+		NameAttribute:  os.Getenv("LDAP_NAME_ATTRIBUTE"),
+		GroupAttribute: os.Getenv("LDAP_GROUP_ATTRIBUTE"),
+		GroupFilter:    os.Getenv("LDAP_GROUP_FILTER"),
+		GroupBaseDN:    os.Getenv("LDAP_GROUP_BASE_DN"),
+		AdminGroups:    splitList(os.Getenv("LDAP_ADMIN_GROUPS")),
+		MemberGroups:   splitList(os.Getenv("LDAP_MEMBER_GROUPS")),
+		DefaultRole:    os.Getenv("LDAP_DEFAULT_ROLE"),
+	}
+
+	if len(p.BaseDN) == 0 {
+		return nil, &errorString{"LDAP_BASE_DN must be set with LDAP_URL"}
+	}
+	if len(p.UserFilter) == 0 {
+		p.UserFilter = "(uid=%s)"
+	}
+	if len(p.NameAttribute) == 0 {
+		p.NameAttribute = "uid"
+	}
+	if len(p.GroupAttribute) == 0 {
+		p.GroupAttribute = "memberOf"
+	}
+	if len(p.GroupBaseDN) == 0 {
+		p.GroupBaseDN = p.BaseDN
+	}
+	if len(p.DefaultRole) == 0 && len(p.MemberGroups) == 0 {
+		p.DefaultRole = RoleMember
+	}
+	if p.DefaultRole == "none" {
+		p.DefaultRole = ""
+	}
+	if len(p.DefaultRole) > 0 && !ValidRole(p.DefaultRole) {
+		return nil, errInvalidRole
+	}
+	return p, nil
+}
+
+func (p *LdapProvider) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(p.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.StartTLS {
+		host := strings.TrimPrefix(strings.TrimPrefix(p.Url, "ldap://"), "ldaps://")
+		host = strings.Split(host, ":")[0]
+		if err = conn.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	if len(p.BindDN) > 0 {
+		err = conn.Bind(p.BindDN, p.BindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Authenticate checks the password of name by binding as its entry
+func (p *LdapProvider) Authenticate(name string, password string) (*LdapUser, error) {
+	// An empty password would be an unauthenticated bind, which succeeds
+	if len(name) == 0 || len(password) == 0 {
+		return nil, ErrLdapCredentials
+	}
+
+	conn, err := p.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		p.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(p.UserFilter, ldap.EscapeFilter(name)),
+		[]string{"dn", p.NameAttribute, p.GroupAttribute},
+		nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Entries) != 1 {
+		return nil, ErrLdapCredentials
+	}
+
+	entry := result.Entries[0]
+	user := LdapUser{
+		DN:     entry.DN,
+		Name:   entry.GetAttributeValue(p.NameAttribute),
+		Groups: entry.GetAttributeValues(p.GroupAttribute),
+	}
+	if len(user.Name) == 0 {
+		return nil, &errorString{fmt.Sprintf("The directory entry has no %s attribute", p.NameAttribute)}
+	}
+
+	if len(p.GroupFilter) > 0 {
+		groups, err := conn.Search(ldap.NewSearchRequest(
+			p.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+			fmt.Sprintf(p.GroupFilter, ldap.EscapeFilter(entry.DN)),
+			[]string{"dn"},
+			nil,
+		))
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups.Entries {
+			user.Groups = append(user.Groups, group.DN)
+		}
+	}
+
+	if err = conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrLdapCredentials
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// inGroups tells if one of groups, DNs, matches one of names, given as DN
+// or common name
+func inGroups(groups []string, names []string) bool {
+	for _, group := range groups {
+		cn := group
+		if dn, err := ldap.ParseDN(group); err == nil && len(dn.RDNs) > 0 && len(dn.RDNs[0].Attributes) > 0 {
+			cn = dn.RDNs[0].Attributes[0].Value
+		}
+		for _, name := range names {
+			if strings.EqualFold(name, group) || strings.EqualFold(name, cn) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Role returns the role given by the groups of user, empty when the user
+// is not allowed at all
+func (p *LdapProvider) Role(user *LdapUser) string {
+	if inGroups(user.Groups, p.AdminGroups) {
+		return RoleAdmin
+	}
+	if inGroups(user.Groups, p.MemberGroups) {
+		return RoleMember
+	}
+	return p.DefaultRole
+}
+
+// identifyLdapAccount authenticates name against the directory and returns
+// the account of its canonical name, created on first login. The role
+// follows the groups of the user at every login.
+func identifyLdapAccount(mongoSession *mgo.Session, name string, password string) (*bson.ObjectId, error) {
+	user, err := Ldap.Authenticate(name, password)
+	if err != nil {
+		return nil, err
+	}
+
+	role := Ldap.Role(user)
+	if len(role) == 0 {
+		return nil, ErrNotAllowed
+	}
+
+	collection := mongoSession.DB(Database).C("accounts")
+
+	var existing *Account
+	err = collection.Find(bson.M{"name": user.Name}).One(&existing)
+	if err != nil && err != mgo.ErrNotFound {
+		return nil, err
+	}
+	// A local account of the same name is not taken over by the directory
+	if existing != nil && existing.Source != SourceLdap {
+		return nil, ErrNameTaken
+	}
+
+	if existing == nil {
+		a := Account{
+			Id:           bson.NewObjectId(),
+			Name:         user.Name,
+			Translations: make([]bson.ObjectId, 0),
+			Role:         role,
+			Source:       SourceLdap,
+		}
+		err = collection.Insert(&a)
+		if mgo.IsDup(err) {
+			return nil, ErrNameTaken
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &a.Id, nil
+	}
+
+	if existing.Disabled {
+		return nil, ErrAccountDisabled
+	}
+
+	if existing.Role != role {
+		err = collection.UpdateId(existing.Id, bson.M{
+			"$set": bson.M{"role": role},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &existing.Id, nil
+}
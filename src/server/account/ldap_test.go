@@ -0,0 +1,85 @@
+package account
+
+import (
+	"os"
+	"testing"
+)
+
+// testLdap is the directory of docker-compose.ldap.yml at LDAP_TEST_URL,
+// the test being skipped when it is not set
+func testLdap(t *testing.T) *LdapProvider {
+	url := os.Getenv("LDAP_TEST_URL")
+	if len(url) == 0 {
+		t.Skip("LDAP_TEST_URL is not set")
+	}
+	return &LdapProvider{
+		Url:            url,
+		BindDN:         "cn=admin,dc=lab,dc=example,dc=org",
+		BindPassword:   "admin",
+		BaseDN:         "ou=people,dc=lab,dc=example,dc=org",
+		UserFilter:     "(uid=%s)",
+		NameAttribute:  "uid",
+		GroupAttribute: "memberOf",
+		AdminGroups:    []string{"s2t-admins"},
+		MemberGroups:   []string{"s2t-members"},
+		DefaultRole:    RoleGuest,
+	}
+}
+
+func TestLdapAuthenticate(t *testing.T) {
+	p := testLdap(t)
+
+	tests := []struct {
+		login    string
+		password string
+		name     string
+		role     string
+		err      error
+	}{
+		{"alice", "password", "alice", RoleAdmin, nil},
+		{"Alice", "password", "alice", RoleAdmin, nil},
+		{"bob", "password", "bob", RoleMember, nil},
+		{"carol", "password", "carol", RoleGuest, nil},
+		{"alice", "wrong", "", "", ErrLdapCredentials},
+		{"alice", "", "", "", ErrLdapCredentials},
+		{"nobody", "password", "", "", ErrLdapCredentials},
+		{"*", "password", "", "", ErrLdapCredentials},
+	}
+
+	for _, test := range tests {
+		t.Run(test.login+"/"+test.password, func(t *testing.T) {
+			user, err := p.Authenticate(test.login, test.password)
+			if err != test.err {
+				t.Fatalf("got %v, want %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+			if user.Name != test.name {
+				t.Errorf("canonical name %s, want %s", user.Name, test.name)
+			}
+			if role := p.Role(user); role != test.role {
+				t.Errorf("role %s, want %s", role, test.role)
+			}
+		})
+	}
+}
+
+func TestInGroups(t *testing.T) {
+	groups := []string{"cn=s2t-admins,ou=groups,dc=lab,dc=example,dc=org"}
+	tests := []struct {
+		names []string
+		want  bool
+	}{
+		{[]string{"s2t-admins"}, true},
+		{[]string{"S2T-Admins"}, true},
+		{[]string{"cn=s2t-admins,ou=groups,dc=lab,dc=example,dc=org"}, true},
+		{[]string{"s2t-members"}, false},
+		{nil, false},
+	}
+	for _, test := range tests {
+		if got := inGroups(groups, test.names); got != test.want {
+			t.Errorf("inGroups(%v) = %v, want %v", test.names, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package account
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"time"
+)
+
+// Lifetime of a share link created without expiry
+const DefaultLinkLifetime = 7 * 24 * time.Hour
+
+var (
+	ErrInvalidLink   = errors.New("Invalid or expired link")
+	ErrLinkPassword  = errors.New("Invalid link password")
+	ErrLinkNoAudio   = errors.New("This link does not give access to the audio")
+	ErrLinkNotOwner  = errors.New("Only the owner of the translation can revoke its links")
+	errLinkInThePast = errors.New("The expiry date of a link must be in the future")
+)
+
+// ShareLink gives read only access to one translation to anyone holding its
+// token, which is only stored hashed
+type ShareLink struct {
+	Id           bson.ObjectId `json:"_id" bson:"_id,omitempty"`
+	TokenHash    string        `json:"-" bson:"token_hash"`
+	Translation  bson.ObjectId `json:"translation" bson:"translation"`
+	CreatedBy    bson.ObjectId `json:"created_by" bson:"created_by"`
+	CreatedAt    time.Time     `json:"created_at" bson:"created_at"`
+	ExpiresAt    time.Time     `json:"expires_at" bson:"expires_at"`
+	PasswordHash string        `json:"-" bson:"password_hash,omitempty"`
+	HasPassword  bool          `json:"has_password" bson:"has_password"`
+	Audio        bool          `json:"audio" bson:"audio"`
+	Revoked      bool          `json:"revoked" bson:"revoked"`
+}
+
+// PublicTranslation is what a share link shows of a translation
+type PublicTranslation struct {
+	FileName    string       `json:"file_name"`
+	Transcripts []Transcript `json:"transcripts"`
+	Speakers    []Speaker    `json:"speakers"`
+	Audio       bool         `json:"audio"`
+}
+
+// RandomToken returns size random bytes encoded for URLs
+func RandomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken is how random tokens are stored, they have enough entropy for
+// a plain SHA-256 to be safe
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateShareLink returns the new link and its token, which cannot be found again
+func CreateShareLink(mongoSession *mgo.Session, t *Translation, author bson.ObjectId, expiresAt time.Time, password string, audio bool) (*ShareLink, string, error) {
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(DefaultLinkLifetime)
+	}
+	if expiresAt.Before(time.Now()) {
+		return nil, "", errLinkInThePast
+	}
+
+	token, err := RandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	link := ShareLink{
+		Id:          bson.NewObjectId(),
+		TokenHash:   HashToken(token),
+		Translation: t.Id,
+		CreatedBy:   author,
+		CreatedAt:   time.Now(),
+		ExpiresAt:   expiresAt,
+		Audio:       audio,
+	}
+
+	if len(password) > 0 {
+		bytesHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, "", err
+		}
+		link.PasswordHash = string(bytesHash)
+		link.HasPassword = true
+	}
+
+	err = mongoSession.DB(Database).C("links").Insert(&link)
+	if err != nil {
+		return nil, "", err
+	}
+	return &link, token, nil
+}
+
+func ListShareLinks(mongoSession *mgo.Session, t *Translation) (links []ShareLink, err error) {
+	links = make([]ShareLink, 0)
+	err = mongoSession.DB(Database).C("links").Find(bson.M{
+		"translation": t.Id,
+	}).Sort("-created_at").All(&links)
+	return links, err
+}
+
+// RevokeShareLink disables a link, if user owns its translation
+func RevokeShareLink(mongoSession *mgo.Session, linkId string, user bson.ObjectId) error {
+	if !bson.IsObjectIdHex(linkId) {
+		return &errorString{"Invalid link id"}
+	}
+
+	collection := mongoSession.DB(Database).C("links")
+	var link ShareLink
+	if err := collection.FindId(bson.ObjectIdHex(linkId)).One(&link); err != nil {
+		return err
+	}
+
+	t, err := AuthorizeTranslation(mongoSession, link.Translation.Hex(), user, AccessOwner)
+	if err == ErrForbidden {
+		return ErrLinkNotOwner
+	}
+	if err != nil {
+		return err
+	}
+
+	return collection.Update(bson.M{
+		"_id":         link.Id,
+		"translation": t.Id,
+	}, bson.M{
+		"$set": bson.M{"revoked": true},
+	})
+}
+
+func ensureLinkIndexes(mongoSession *mgo.Session) error {
+	return mongoSession.DB(Database).C("links").EnsureIndex(mgo.Index{
+		Key:    []string{"token_hash"},
+		Unique: true,
+	})
+}
+
+// checkLinkPassword compares password to the one of link, wrong passwords
+// being throttled per link and per ip like logins
+func checkLinkPassword(mongoSession *mgo.Session, link *ShareLink, password string, ip string) error {
+	now := time.Now()
+	if _, err := reserveAttempt(mongoSession, linkAttemptsKey(link.Id), LoginMaxAttempts, now); err != nil {
+		return err
+	}
+	if _, err := reserveAttempt(mongoSession, ipAttemptsKey(ip), LoginMaxIpAttempts, now); err != nil {
+		if refundErr := refundAttempt(mongoSession, linkAttemptsKey(link.Id), LoginMaxAttempts); refundErr != nil {
+			return refundErr
+		}
+		return err
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)) == nil {
+		if err := refundAttempt(mongoSession, ipAttemptsKey(ip), LoginMaxIpAttempts); err != nil {
+			return err
+		}
+		err := mongoSession.DB(Database).C("login_attempts").RemoveId(linkAttemptsKey(link.Id))
+		if err == mgo.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+
+	return ErrLinkPassword
+}
+
+// OpenShareLink returns the translation of a valid link after checking its
+// password, opened from ip
+func OpenShareLink(mongoSession *mgo.Session, token string, password string, ip string) (*ShareLink, *Translation, error) {
+	var link ShareLink
+	err := mongoSession.DB(Database).C("links").Find(bson.M{
+		"token_hash": HashToken(token),
+	}).One(&link)
+	if err == mgo.ErrNotFound {
+		return nil, nil, ErrInvalidLink
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if link.Revoked || link.ExpiresAt.Before(time.Now()) {
+		return nil, nil, ErrInvalidLink
+	}
+
+	if link.HasPassword {
+		if err = checkLinkPassword(mongoSession, &link, password, ip); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var t Translation
+	err = mongoSession.DB(Database).C("translations").FindId(link.Translation).One(&t)
+	if err == mgo.ErrNotFound {
+		return nil, nil, ErrInvalidLink
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &link, &t, nil
+}
+
+func (t *Translation) Public(link *ShareLink) PublicTranslation {
+	t.ApplySpeakers()
+	return PublicTranslation{
+		FileName:    t.FileName,
+		Transcripts: t.CurrentTranscripts(),
+		Speakers:    t.Speakers,
+		Audio:       link.Audio && len(t.Audio) > 0,
+	}
+}
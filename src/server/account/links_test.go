@@ -0,0 +1,41 @@
+package account
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestHashToken(t *testing.T) {
+	tests := map[string]string{
+		"":    "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		"abc": "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+	}
+	for token, want := range tests {
+		if got := HashToken(token); got != want {
+			t.Errorf("HashToken(%q) = %s, want %s", token, got, want)
+		}
+	}
+}
+
+func TestRandomToken(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, size := range []int{16, 24, 32} {
+		for i := 0; i < 10; i++ {
+			token, err := RandomToken(size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := base64.RawURLEncoding.DecodeString(token)
+			if err != nil {
+				t.Fatalf("%q is not URL safe: %v", token, err)
+			}
+			if len(decoded) != size {
+				t.Errorf("RandomToken(%d) has %d bytes", size, len(decoded))
+			}
+			if seen[token] {
+				t.Errorf("RandomToken(%d) repeated %q", size, token)
+			}
+			seen[token] = true
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package account
+
+import (
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"time"
+)
+
+const (
+	maxTitleLength       = 200
+	maxDescriptionLength = 2000
+	maxNotesLength       = 20000
+)
+
+// Metadata are the fields of a translation edited by the users, the ones
+// left nil being kept
+type Metadata struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	Notes       *string `json:"notes"`
+}
+
+// SetMetadata changes the title, description and notes of t
+func SetMetadata(mongoSession *mgo.Session, t *Translation, metadata Metadata) error {
+	set := bson.M{"updated_at": time.Now()}
+	unset := bson.M{}
+	fields := []struct {
+		name  string
+		value *string
+		max   int
+		error string
+	}{
+		{"title", metadata.Title, maxTitleLength, "Titles are at most 200 characters long"},
+		{"description", metadata.Description, maxDescriptionLength, "Descriptions are at most 2000 characters long"},
+		{"notes", metadata.Notes, maxNotesLength, "Notes are at most 20000 characters long"},
+	}
+	for _, field := range fields {
+		if field.value == nil {
+			continue
+		}
+		value := strings.TrimSpace(*field.value)
+		if len([]rune(value)) > field.max {
+			return &errorString{field.error}
+		}
+		if len(value) == 0 {
+			unset[field.name] = ""
+		} else {
+			set[field.name] = value
+		}
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return mongoSession.DB(Database).C("translations").UpdateId(t.Id, update)
+}
@@ -0,0 +1,35 @@
+package account
+
+import (
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"os"
+	"testing"
+)
+
+// testMongo connects to MONGO_TEST_HOST, the test being skipped when it is
+// not set, and points the package to a throwaway database with its indexes,
+// dropped once the test is over
+func testMongo(t *testing.T) *mgo.Session {
+	host := os.Getenv("MONGO_TEST_HOST")
+	if len(host) == 0 {
+		t.Skip("MONGO_TEST_HOST is not set")
+	}
+	session, err := mgo.Dial(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	database := Database
+	Database = "s2t_test_" + bson.NewObjectId().Hex()
+	t.Cleanup(func() {
+		_ = session.DB(Database).DropDatabase()
+		Database = database
+		session.Close()
+	})
+
+	if err = EnsureIndexes(session); err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
@@ -0,0 +1,68 @@
+package account
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// Notifier delivers messages to users, such as password reset links
+type Notifier interface {
+	Send(to string, subject string, body string) error
+}
+
+// LogNotifier writes messages to the server log, for development
+type LogNotifier struct{}
+
+func (LogNotifier) Send(to string, subject string, body string) error {
+	log.Printf("message to %s: %s\n%s", to, subject, body)
+	return nil
+}
+
+// SmtpNotifier sends messages by email
+type SmtpNotifier struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (n *SmtpNotifier) Send(to string, subject string, body string) error {
+	var auth smtp.Auth
+	if len(n.Username) > 0 {
+		host := strings.Split(n.Addr, ":")[0]
+		auth = smtp.PlainAuth("", n.Username, n.Password, host)
+	}
+
+	// Header values come from the server, line breaks are removed so
+	// that no header can be added through them
+	clean := strings.NewReplacer("\r", "", "\n", "")
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s",
+		clean.Replace(n.From), clean.Replace(to), clean.Replace(subject), time.Now().Format(time.RFC1123Z), body)
+	return smtp.SendMail(n.Addr, auth, n.From, []string{to}, []byte(msg))
+}
+
+// NewNotifier returns the notifier chosen by the NOTIFIER environment
+// variable, log by default
+func NewNotifier() (Notifier, error) {
+	switch os.Getenv("NOTIFIER") {
+	case "", "log":
+		return LogNotifier{}, nil
+	case "smtp":
+		n := &SmtpNotifier{
+			Addr:     os.Getenv("SMTP_ADDR"),
+			From:     os.Getenv("SMTP_FROM"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+		if len(n.Addr) == 0 || len(n.From) == 0 {
+			return nil, &errorString{"SMTP_ADDR and SMTP_FROM must be set with NOTIFIER=smtp"}
+		}
+		return n, nil
+	default:
+		return nil, &errorString{"Unknown NOTIFIER " + os.Getenv("NOTIFIER")}
+	}
+}
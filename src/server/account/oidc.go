@@ -0,0 +1,592 @@
+package account
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SourceOidc marks the accounts created by an identity provider login
+const SourceOidc = "oidc"
+
+// Time given to users to log in at the identity provider
+const oidcStateLifetime = 10 * time.Minute
+
+var (
+	ErrInvalidOidcState = errors.New("Invalid or expired login, please try again")
+	ErrInvalidIdToken   = errors.New("Invalid ID token")
+	ErrOidcNameTaken    = errors.New("An account with this name already exists, log in to it and link it to your identity provider")
+	ErrOidcLinked       = errors.New("This identity is already linked to another account")
+)
+
+// Oidc logs users in with an OpenID Connect identity provider when it is
+// configured
+var Oidc *OidcProvider
+
+// OidcIdentity is the user of an identity provider an account is linked to
+type OidcIdentity struct {
+	Issuer  string `json:"issuer" bson:"issuer"`
+	Subject string `json:"subject" bson:"subject"`
+}
+
+// OidcProvider runs the authorization code flow with PKCE against an
+// issuer found by discovery
+type OidcProvider struct {
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	// RedirectUrl is the /oidc/callback route as seen by browsers
+	RedirectUrl string
+	Scopes      string
+	// NameClaim of the ID token names new accounts
+	NameClaim string
+	// FrontendUrl receives the session token after login
+	FrontendUrl string
+	DefaultRole string
+
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]*rsa.PublicKey
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+// oidcState is a login started at the identity provider, found back by the
+// hash of its state parameter
+type oidcState struct {
+	Id        bson.ObjectId `bson:"_id"`
+	StateHash string        `bson:"state_hash"`
+	Verifier  string        `bson:"verifier"`
+	Nonce     string        `bson:"nonce"`
+	Redirect  string        `bson:"redirect,omitempty"`
+	// Link is set when a logged in user links their account
+	Link      bson.ObjectId `bson:"link,omitempty"`
+	ExpiresAt time.Time     `bson:"expires_at"`
+}
+
+// IdToken holds the claims of a validated ID token
+type IdToken struct {
+	Subject string
+	Name    string
+	Email   string
+}
+
+// NewOidcProvider reads the OIDC_* environment variables, it returns nil
+// when OIDC_ISSUER is not set. Discovery happens on the first login.
+func NewOidcProvider() (*OidcProvider, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if len(issuer) == 0 {
+		return nil, nil
+	}
+
+	p := &OidcProvider{
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		ClientId:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectUrl:  os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:       os.Getenv("OIDC_SCOPES"),
+		NameClaim:    os.Getenv("OIDC_NAME_CLAIM"),
+		FrontendUrl:  os.Getenv("OIDC_FRONTEND_URL"),
+		DefaultRole:  os.Getenv("OIDC_DEFAULT_ROLE"),
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+
+	if len(p.ClientId) == 0 || len(p.RedirectUrl) == 0 {
+		return nil, &errorString{"OIDC_CLIENT_ID and OIDC_REDIRECT_URL must be set with OIDC_ISSUER"}
+	}
+	if len(p.Scopes) == 0 {
+		p.Scopes = "openid profile email"
+	}
+	if len(p.NameClaim) == 0 {
+		p.NameClaim = "preferred_username"
+	}
+	if len(p.DefaultRole) == 0 {
+		p.DefaultRole = RoleMember
+	}
+	if !ValidRole(p.DefaultRole) {
+		return nil, errInvalidRole
+	}
+	return p, nil
+}
+
+func ensureOidcIndexes(mongoSession *mgo.Session) error {
+	err := mongoSession.DB(Database).C("oidc_states").EnsureIndex(mgo.Index{
+		Key:         []string{"expires_at"},
+		ExpireAfter: time.Second,
+	})
+	if err != nil {
+		return err
+	}
+	return mongoSession.DB(Database).C("accounts").EnsureIndex(mgo.Index{
+		Key:    []string{"oidc.issuer", "oidc.subject"},
+		Unique: true,
+		Sparse: true,
+	})
+}
+
+func (p *OidcProvider) getJson(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (p *OidcProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var d oidcDiscovery
+	if err := p.getJson(ctx, p.Issuer+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("discovery returned issuer %s instead of %s", d.Issuer, p.Issuer)
+	}
+	p.discovery = &d
+	return &d, nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// key returns the signing key kid, fetching the keys of the issuer again
+// when it is unknown as they may have been rotated
+func (p *OidcProvider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err = p.getJson(ctx, d.JwksUri, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (len(k.Use) > 0 && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	p.keys = keys
+
+	key, ok := keys[kid]
+	if !ok {
+		return nil, ErrInvalidIdToken
+	}
+	return key, nil
+}
+
+// pkceChallenge is the S256 challenge of verifier
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// allowedRedirect tells if the browser can be sent to redirect with its
+// session token: a page of the front-end, on its scheme and host and under
+// its path
+func (p *OidcProvider) allowedRedirect(redirect string) bool {
+	if len(p.FrontendUrl) == 0 {
+		return false
+	}
+	front, err := url.Parse(p.FrontendUrl)
+	if err != nil {
+		return false
+	}
+	target, err := url.Parse(redirect)
+	if err != nil || target.User != nil || len(target.Opaque) > 0 || len(target.Fragment) > 0 {
+		return false
+	}
+	if !strings.EqualFold(target.Scheme, front.Scheme) || !strings.EqualFold(target.Host, front.Host) {
+		return false
+	}
+
+	if strings.Contains(target.Path, "..") || strings.Contains(target.Path, "\\") {
+		return false
+	}
+	base := strings.TrimSuffix(front.Path, "/")
+	return target.Path == base || strings.HasPrefix(target.Path, base+"/")
+}
+
+// AuthorizationUrl starts a login, or the linking of the account link when
+// it is set, and returns the URL of the identity provider to send the
+// browser to. redirect is where the browser goes back after login.
+func (p *OidcProvider) AuthorizationUrl(ctx context.Context, mongoSession *mgo.Session, redirect string, link bson.ObjectId) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if len(redirect) > 0 && !p.allowedRedirect(redirect) {
+		return "", &errorString{"Invalid redirect"}
+	}
+
+	state, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	verifier, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	err = mongoSession.DB(Database).C("oidc_states").Insert(&oidcState{
+		Id:        bson.NewObjectId(),
+		StateHash: HashToken(state),
+		Verifier:  verifier,
+		Nonce:     nonce,
+		Redirect:  redirect,
+		Link:      link,
+		ExpiresAt: time.Now().Add(oidcStateLifetime),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientId},
+		"redirect_uri":          {p.RedirectUrl},
+		"scope":                 {p.Scopes},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {pkceChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return d.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// consumeState returns the login of state, which can only be used once
+func consumeState(mongoSession *mgo.Session, state string) (*oidcState, error) {
+	var s oidcState
+	_, err := mongoSession.DB(Database).C("oidc_states").Find(bson.M{
+		"state_hash": HashToken(state),
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Apply(mgo.Change{Remove: true}, &s)
+	if err == mgo.ErrNotFound {
+		return nil, ErrInvalidOidcState
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// exchange trades an authorization code for the raw ID token
+func (p *OidcProvider) exchange(ctx context.Context, code string, verifier string) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectUrl},
+		"client_id":     {p.ClientId},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if len(p.ClientSecret) > 0 {
+		req.SetBasicAuth(url.QueryEscape(p.ClientId), url.QueryEscape(p.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IdToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK || len(body.Error) > 0 {
+		return "", fmt.Errorf("token request failed: %s %s", body.Error, body.ErrorDescription)
+	}
+	if len(body.IdToken) == 0 {
+		return "", ErrInvalidIdToken
+	}
+	return body.IdToken, nil
+}
+
+// audience is a string or a list of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	err := json.Unmarshal(data, &list)
+	*a = list
+	return err
+}
+
+func (a audience) contains(clientId string) bool {
+	for _, aud := range a {
+		if aud == clientId {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed difference between our clock and the one of the issuer
+const clockSkew = time.Minute
+
+// validate checks the RS256 signature and the claims of an ID token
+func (p *OidcProvider) validate(ctx context.Context, raw string, nonce string) (*IdToken, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidIdToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	headerJson, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(headerJson, &header) != nil {
+		return nil, ErrInvalidIdToken
+	}
+	// Only RS256 is accepted, which rules out unsigned and HMAC tokens
+	if header.Alg != "RS256" {
+		return nil, ErrInvalidIdToken
+	}
+
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidIdToken
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+		return nil, ErrInvalidIdToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidIdToken
+	}
+	var claims map[string]interface{}
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidIdToken
+	}
+	var registered struct {
+		Issuer   string   `json:"iss"`
+		Subject  string   `json:"sub"`
+		Audience audience `json:"aud"`
+		Azp      string   `json:"azp"`
+		Expiry   int64    `json:"exp"`
+		IssuedAt int64    `json:"iat"`
+		Nonce    string   `json:"nonce"`
+	}
+	if err = json.Unmarshal(payload, &registered); err != nil {
+		return nil, ErrInvalidIdToken
+	}
+
+	now := time.Now()
+	switch {
+	case strings.TrimSuffix(registered.Issuer, "/") != p.Issuer,
+		len(registered.Subject) == 0,
+		!registered.Audience.contains(p.ClientId),
+		len(registered.Audience) > 1 && registered.Azp != p.ClientId,
+		now.After(time.Unix(registered.Expiry, 0).Add(clockSkew)),
+		time.Unix(registered.IssuedAt, 0).After(now.Add(clockSkew)),
+		registered.Nonce != nonce:
+		return nil, ErrInvalidIdToken
+	}
+
+	token := IdToken{Subject: registered.Subject}
+	token.Name, _ = claims[p.NameClaim].(string)
+	token.Email, _ = claims["email"].(string)
+	return &token, nil
+}
+
+// Callback completes a login with the code and state given by the identity
+// provider. It returns the account to open a session for, created or linked
+// as needed, and where to send the browser.
+func (p *OidcProvider) Callback(ctx context.Context, mongoSession *mgo.Session, code string, state string) (*Account, string, error) {
+	s, err := consumeState(mongoSession, state)
+	if err != nil {
+		return nil, "", err
+	}
+
+	raw, err := p.exchange(ctx, code, s.Verifier)
+	if err != nil {
+		return nil, "", err
+	}
+
+	token, err := p.validate(ctx, raw, s.Nonce)
+	if err != nil {
+		return nil, "", err
+	}
+
+	identity := OidcIdentity{Issuer: p.Issuer, Subject: token.Subject}
+	redirect := s.Redirect
+	if len(redirect) == 0 {
+		redirect = p.FrontendUrl
+	}
+
+	var a *Account
+	if len(s.Link) > 0 {
+		a, err = linkOidcAccount(mongoSession, s.Link, identity)
+	} else {
+		a, err = findOidcAccount(mongoSession, identity, token, p.DefaultRole)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if a.Disabled {
+		return nil, "", ErrAccountDisabled
+	}
+	return a, redirect, nil
+}
+
+func linkOidcAccount(mongoSession *mgo.Session, user bson.ObjectId, identity OidcIdentity) (*Account, error) {
+	collection := mongoSession.DB(Database).C("accounts")
+	err := collection.UpdateId(user, bson.M{
+		"$set": bson.M{"oidc": identity},
+	})
+	if mgo.IsDup(err) {
+		return nil, ErrOidcLinked
+	}
+	if err != nil {
+		return nil, err
+	}
+	return FindAccount(mongoSession, user)
+}
+
+// findOidcAccount returns the account linked to identity, creating it on
+// first login
+func findOidcAccount(mongoSession *mgo.Session, identity OidcIdentity, token *IdToken, role string) (*Account, error) {
+	collection := mongoSession.DB(Database).C("accounts")
+
+	var a Account
+	err := collection.Find(bson.M{
+		"oidc.issuer":  identity.Issuer,
+		"oidc.subject": identity.Subject,
+	}).One(&a)
+	if err == nil {
+		return &a, nil
+	}
+	if err != mgo.ErrNotFound {
+		return nil, err
+	}
+
+	name := token.Name
+	if len(name) == 0 {
+		name = token.Email
+	}
+	if len(name) == 0 {
+		name = token.Subject
+	}
+
+	count, err := collection.Find(bson.M{"name": name}).Count()
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrOidcNameTaken
+	}
+
+	a = Account{
+		Id:           bson.NewObjectId(),
+		Name:         name,
+		Translations: make([]bson.ObjectId, 0),
+		Role:         role,
+		Source:       SourceOidc,
+		Oidc:         &identity,
+	}
+	err = collection.Insert(&a)
+	if mgo.IsDup(err) {
+		return nil, ErrOidcNameTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
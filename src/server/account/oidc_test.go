@@ -0,0 +1,237 @@
+package account
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testIssuer is a mock identity provider serving discovery and its keys
+type testIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &testIssuer{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                issuer.server.URL,
+			AuthorizationEndpoint: issuer.server.URL + "/authorize",
+			TokenEndpoint:         issuer.server.URL + "/token",
+			JwksUri:               issuer.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []jsonWebKey{{
+				Kty: "RSA",
+				Kid: "test",
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+func (i *testIssuer) provider() *OidcProvider {
+	return &OidcProvider{
+		Issuer:    i.server.URL,
+		ClientId:  "s2t",
+		NameClaim: "preferred_username",
+		client:    i.server.Client(),
+	}
+}
+
+// sign makes a token of claims with the header alg and kid, signed with
+// the key of the issuer
+func (i *testIssuer) sign(t *testing.T, alg string, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, i.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestOidcValidate(t *testing.T) {
+	issuer := newTestIssuer(t)
+	now := time.Now()
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss":                issuer.server.URL,
+			"sub":                "user-1",
+			"aud":                "s2t",
+			"exp":                now.Add(time.Hour).Unix(),
+			"iat":                now.Unix(),
+			"nonce":              "nonce",
+			"preferred_username": "jdoe",
+			"email":              "jdoe@example.org",
+		}
+		for k, v := range changes {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token func() string
+		valid bool
+	}{
+		{
+			name:  "valid",
+			token: func() string { return issuer.sign(t, "RS256", "test", claims(nil)) },
+			valid: true,
+		},
+		{
+			name: "audience list with azp",
+			token: func() string {
+				return issuer.sign(t, "RS256", "test", claims(map[string]interface{}{"aud": []string{"s2t", "other"}, "azp": "s2t"}))
+			},
+			valid: true,
+		},
+		{
+			name: "audience list without azp",
+			token: func() string {
+				return issuer.sign(t, "RS256", "test", claims(map[string]interface{}{"aud": []string{"s2t", "other"}}))
+			},
+		},
+		{
+			name:  "other audience",
+			token: func() string { return issuer.sign(t, "RS256", "test", claims(map[string]interface{}{"aud": "other"})) },
+		},
+		{
+			name: "other issuer",
+			token: func() string {
+				return issuer.sign(t, "RS256", "test", claims(map[string]interface{}{"iss": "https://evil.example.org"}))
+			},
+		},
+		{
+			name: "wrong nonce",
+			token: func() string {
+				return issuer.sign(t, "RS256", "test", claims(map[string]interface{}{"nonce": "other"}))
+			},
+		},
+		{
+			name: "expired",
+			token: func() string {
+				return issuer.sign(t, "RS256", "test", claims(map[string]interface{}{"exp": now.Add(-time.Hour).Unix()}))
+			},
+		},
+		{
+			name: "issued in the future",
+			token: func() string {
+				return issuer.sign(t, "RS256", "test", claims(map[string]interface{}{"iat": now.Add(time.Hour).Unix()}))
+			},
+		},
+		{
+			name:  "no subject",
+			token: func() string { return issuer.sign(t, "RS256", "test", claims(map[string]interface{}{"sub": nil})) },
+		},
+		{
+			name:  "other algorithm",
+			token: func() string { return issuer.sign(t, "HS256", "test", claims(nil)) },
+		},
+		{
+			name:  "unknown key",
+			token: func() string { return issuer.sign(t, "RS256", "rotated", claims(nil)) },
+		},
+		{
+			name: "unsigned",
+			token: func() string {
+				header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+				payload, _ := json.Marshal(claims(nil))
+				return header + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+			},
+		},
+		{
+			name: "tampered",
+			token: func() string {
+				signed := issuer.sign(t, "RS256", "test", claims(nil))
+				payload, _ := json.Marshal(claims(map[string]interface{}{"sub": "admin"}))
+				parts := strings.Split(signed, ".")
+				return parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token, err := issuer.provider().validate(context.Background(), test.token(), "nonce")
+			if !test.valid {
+				if err == nil {
+					t.Fatalf("accepted %+v", token)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.Subject != "user-1" || token.Name != "jdoe" || token.Email != "jdoe@example.org" {
+				t.Errorf("validate() = %+v", token)
+			}
+		})
+	}
+}
+
+func TestOidcAllowedRedirect(t *testing.T) {
+	p := &OidcProvider{FrontendUrl: "https://front.example.org/app"}
+	tests := []struct {
+		redirect string
+		want     bool
+	}{
+		{"https://front.example.org/app", true},
+		{"https://front.example.org/app/", true},
+		{"https://front.example.org/app/login?next=1", true},
+		{"https://FRONT.example.org/app/login", true},
+		{"https://front.example.org.evil.com/app", false},
+		{"https://front.example.org@evil.com/app", false},
+		{"https://user@front.example.org/app", false},
+		{"https://front.example.org:8443/app", false},
+		{"http://front.example.org/app", false},
+		{"https://front.example.org/application", false},
+		{"https://front.example.org/other", false},
+		{"https://front.example.org/app/../other", false},
+		{"https://front.example.org/app#token=x", false},
+		{"//evil.com/app", false},
+		{"/app", false},
+		{"javascript:alert(1)", false},
+	}
+	for _, test := range tests {
+		if got := p.allowedRedirect(test.redirect); got != test.want {
+			t.Errorf("allowedRedirect(%s) = %v, want %v", test.redirect, got, test.want)
+		}
+	}
+
+	if (&OidcProvider{}).allowedRedirect("https://front.example.org/app") {
+		t.Error("redirects are allowed without front-end")
+	}
+}
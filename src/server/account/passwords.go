@@ -0,0 +1,203 @@
+package account
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"log"
+	"time"
+)
+
+const (
+	AuditPasswordChanged = "password_changed"
+	AuditPasswordReset   = "password_reset"
+)
+
+var (
+	// PasswordResetLifetime is how long a reset link can be used
+	PasswordResetLifetime = time.Hour
+	// PasswordResetUrl is the front-end page resetting passwords, the token
+	// being added as its token parameter
+	PasswordResetUrl string
+)
+
+var (
+	ErrWrongPassword      = errors.New("Wrong password")
+	ErrInvalidResetToken  = errors.New("Invalid or expired password reset link")
+	errLocalPasswordOnly  = errors.New("The password of this account is managed by its identity provider")
+	errMissingNewPassword = errors.New("Missing new password")
+)
+
+// passwordReset lets the holder of its token set a new password once
+type passwordReset struct {
+	Id        bson.ObjectId `bson:"_id"`
+	TokenHash string        `bson:"token_hash"`
+	User      bson.ObjectId `bson:"user"`
+	ExpiresAt time.Time     `bson:"expires_at"`
+}
+
+func ensurePasswordResetIndexes(mongoSession *mgo.Session) error {
+	return mongoSession.DB(Database).C("password_resets").EnsureIndex(mgo.Index{
+		Key:         []string{"expires_at"},
+		ExpireAfter: time.Second,
+	})
+}
+
+func hashPassword(password string) (string, error) {
+	bytesHash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	return string(bytesHash), err
+}
+
+// ChangePassword replaces the password of the user of session after
+// checking the current one, and ends their other sessions and API keys
+func ChangePassword(mongoSession *mgo.Session, session *Session, current string, password string) error {
+	a, err := FindAccount(mongoSession, session.User)
+	if err != nil {
+		return err
+	}
+	if len(a.Source) > 0 {
+		return errLocalPasswordOnly
+	}
+	if len(password) == 0 {
+		return errMissingNewPassword
+	}
+	if bcrypt.CompareHashAndPassword([]byte(a.Password), []byte(current)) != nil {
+		return ErrWrongPassword
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	err = mongoSession.DB(Database).C("accounts").UpdateId(a.Id, bson.M{
+		"$set": bson.M{"password": hash},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = mongoSession.DB(Database).C("sessions").RemoveAll(bson.M{
+		"user": a.Id,
+		"_id":  bson.M{"$ne": session.Id},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err = mongoSession.DB(Database).C("apikeys").RemoveAll(bson.M{"user": a.Id}); err != nil {
+		return err
+	}
+
+	Audit(mongoSession, AuditEvent{Type: AuditPasswordChanged, Account: a.Id, Name: a.Name, Actor: a.Id})
+	return nil
+}
+
+// RequestPasswordReset sends a reset link to the local accounts named or
+// with the email identifier. Nothing tells the caller whether one exists.
+func RequestPasswordReset(mongoSession *mgo.Session, notifier Notifier, identifier string) error {
+	if len(identifier) == 0 {
+		return nil
+	}
+
+	var accounts []Account
+	err := mongoSession.DB(Database).C("accounts").Find(bson.M{
+		"$or":      []bson.M{{"name": identifier}, {"email": identifier}},
+		"source":   bson.M{"$exists": false},
+		"disabled": bson.M{"$ne": true},
+	}).All(&accounts)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range accounts {
+		if len(a.Email) == 0 {
+			log.Printf("password reset of account %s without email", a.Name)
+			continue
+		}
+
+		token, err := RandomToken(32)
+		if err != nil {
+			return err
+		}
+		err = mongoSession.DB(Database).C("password_resets").Insert(&passwordReset{
+			Id:        bson.NewObjectId(),
+			TokenHash: HashToken(token),
+			User:      a.Id,
+			ExpiresAt: time.Now().Add(PasswordResetLifetime),
+		})
+		if err != nil {
+			return err
+		}
+
+		link := token
+		if len(PasswordResetUrl) > 0 {
+			link = PasswordResetUrl + "?token=" + token
+		}
+		body := fmt.Sprintf("A new password was requested for the account %s.\n\nSet it within %s with:\n%s\n\nIf you did not ask for it, ignore this message.\n",
+			a.Name, PasswordResetLifetime, link)
+		if err = notifier.Send(a.Email, "Password reset", body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResetPasswordWithToken sets the password of the account of a reset token,
+// which is used up along with the other ones of the account, and ends all
+// its sessions and API keys
+func ResetPasswordWithToken(mongoSession *mgo.Session, token string, password string) error {
+	if len(password) == 0 {
+		return errMissingNewPassword
+	}
+
+	collection := mongoSession.DB(Database).C("password_resets")
+	var reset passwordReset
+	_, err := collection.Find(bson.M{
+		"token_hash": HashToken(token),
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Apply(mgo.Change{Remove: true}, &reset)
+	if err == mgo.ErrNotFound {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+
+	a, err := FindAccount(mongoSession, reset.User)
+	if err != nil {
+		return err
+	}
+	if a.Disabled {
+		return ErrAccountDisabled
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	err = mongoSession.DB(Database).C("accounts").UpdateId(a.Id, bson.M{
+		"$set": bson.M{"password": hash},
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err = collection.RemoveAll(bson.M{"user": a.Id}); err != nil {
+		return err
+	}
+	if _, err = mongoSession.DB(Database).C("sessions").RemoveAll(bson.M{"user": a.Id}); err != nil {
+		return err
+	}
+	if _, err = mongoSession.DB(Database).C("apikeys").RemoveAll(bson.M{"user": a.Id}); err != nil {
+		return err
+	}
+	if err = RecordLoginSuccess(mongoSession, a.Name); err != nil {
+		return err
+	}
+
+	Audit(mongoSession, AuditEvent{Type: AuditPasswordReset, Account: a.Id, Name: a.Name})
+	return nil
+}
@@ -0,0 +1,397 @@
+package account
+
+import (
+	"errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"sort"
+	"strings"
+	"time"
+)
+
+const maxTagLength = 50
+
+var (
+	ErrProjectForbidden = errors.New("You cannot change this project")
+	errInvalidProject   = errors.New("Invalid project id")
+	errProjectCycle     = errors.New("A project cannot be moved into itself or one of its subprojects")
+	errProjectScope     = errors.New("Projects can only be moved among the projects of the same account or team")
+	errTranslationScope = errors.New("Translations can only be filed in the projects of their owner or of their team")
+)
+
+// Project is a folder of translations, nested in its Parent. It belongs to
+// an account, or to a team when Team is set.
+type Project struct {
+	Id        bson.ObjectId `json:"_id" bson:"_id,omitempty"`
+	Name      string        `json:"name" bson:"name"`
+	Parent    bson.ObjectId `json:"parent,omitempty" bson:"parent,omitempty"`
+	Owner     bson.ObjectId `json:"owner,omitempty" bson:"owner,omitempty"`
+	Team      bson.ObjectId `json:"team,omitempty" bson:"team,omitempty"`
+	CreatedAt time.Time     `json:"created_at" bson:"created_at"`
+}
+
+// TranslationFilter restricts the translations listed by FullAccount and
+// SearchTranslations, an empty filter keeping them all
+type TranslationFilter struct {
+	// Projects are the project asked for and its subprojects
+	Projects []bson.ObjectId
+	Tag      string
+}
+
+func ensureProjectIndexes(mongoSession *mgo.Session) error {
+	err := mongoSession.DB(Database).C("projects").EnsureIndex(mgo.Index{
+		Key: []string{"owner"},
+	})
+	if err != nil {
+		return err
+	}
+	err = mongoSession.DB(Database).C("projects").EnsureIndex(mgo.Index{
+		Key: []string{"team"},
+	})
+	if err != nil {
+		return err
+	}
+	return mongoSession.DB(Database).C("translations").EnsureIndex(mgo.Index{
+		Key: []string{"tags"},
+	})
+}
+
+// sameScope tells if two projects belong to the same account or team
+func (p *Project) sameScope(other *Project) bool {
+	return p.Owner == other.Owner && p.Team == other.Team
+}
+
+// holds tells if t can be filed in p, the projects of an account holding
+// its translations and the projects of a team the translations of the team
+func (p *Project) holds(t *Translation) bool {
+	if len(p.Team) > 0 {
+		return p.Team == t.Team
+	}
+	return p.Owner == t.Owner
+}
+
+// ListProjects returns the projects of user and of their teams
+func ListProjects(mongoSession *mgo.Session, user bson.ObjectId) ([]Project, error) {
+	teams, err := TeamIds(mongoSession, user)
+	if err != nil {
+		return nil, err
+	}
+	projects := make([]Project, 0)
+	err = mongoSession.DB(Database).C("projects").Find(bson.M{
+		"$or": []bson.M{
+			{"owner": user},
+			{"team": bson.M{"$in": teams}},
+		},
+	}).Sort("name").All(&projects)
+	return projects, err
+}
+
+// findProject returns the project projectId if user can see it, and
+// whether they can change it
+func findProject(mongoSession *mgo.Session, projectId string, user bson.ObjectId) (*Project, bool, error) {
+	if !bson.IsObjectIdHex(projectId) {
+		return nil, false, errInvalidProject
+	}
+	var p Project
+	err := mongoSession.DB(Database).C("projects").FindId(bson.ObjectIdHex(projectId)).One(&p)
+	if err == mgo.ErrNotFound {
+		return nil, false, errInvalidProject
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(p.Team) == 0 {
+		if p.Owner != user {
+			return nil, false, errInvalidProject
+		}
+		return &p, true, nil
+	}
+
+	access, err := teamAccess(mongoSession, p.Team, user)
+	if err != nil {
+		return nil, false, err
+	}
+	if access == AccessNone {
+		return nil, false, errInvalidProject
+	}
+	return &p, AccessAllows(access, AccessEditor), nil
+}
+
+// EditableProject returns the project projectId if user can change it
+func EditableProject(mongoSession *mgo.Session, projectId string, user bson.ObjectId) (*Project, error) {
+	p, editable, err := findProject(mongoSession, projectId, user)
+	if err != nil {
+		return nil, err
+	}
+	if !editable {
+		return nil, ErrProjectForbidden
+	}
+	return p, nil
+}
+
+// CreateProject makes a project of user in parentId, or at the top of
+// their projects or of the projects of teamId
+func CreateProject(mongoSession *mgo.Session, user bson.ObjectId, name string, parentId string, teamId string) (*Project, error) {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		return nil, &errorString{"Missing project name"}
+	}
+
+	p := Project{
+		Id:        bson.NewObjectId(),
+		Name:      name,
+		CreatedAt: time.Now(),
+	}
+
+	switch {
+	case len(parentId) > 0:
+		parent, err := EditableProject(mongoSession, parentId, user)
+		if err != nil {
+			return nil, err
+		}
+		p.Parent = parent.Id
+		p.Owner = parent.Owner
+		p.Team = parent.Team
+	case len(teamId) > 0:
+		team, err := MemberTeam(mongoSession, teamId, user)
+		if err != nil {
+			return nil, err
+		}
+		if !AccessAllows(TeamAccess(team.RoleOf(user)), AccessEditor) {
+			return nil, ErrProjectForbidden
+		}
+		p.Team = team.Id
+	default:
+		p.Owner = user
+	}
+
+	if err := mongoSession.DB(Database).C("projects").Insert(&p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func RenameProject(mongoSession *mgo.Session, user bson.ObjectId, projectId string, name string) error {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		return &errorString{"Missing project name"}
+	}
+	p, err := EditableProject(mongoSession, projectId, user)
+	if err != nil {
+		return err
+	}
+	return mongoSession.DB(Database).C("projects").UpdateId(p.Id, bson.M{
+		"$set": bson.M{"name": name},
+	})
+}
+
+// MoveProject nests a project in parentId, or moves it to the top when
+// parentId is empty
+func MoveProject(mongoSession *mgo.Session, user bson.ObjectId, projectId string, parentId string) error {
+	p, err := EditableProject(mongoSession, projectId, user)
+	if err != nil {
+		return err
+	}
+	collection := mongoSession.DB(Database).C("projects")
+
+	if len(parentId) == 0 {
+		return collection.UpdateId(p.Id, bson.M{
+			"$unset": bson.M{"parent": ""},
+		})
+	}
+
+	parent, err := EditableProject(mongoSession, parentId, user)
+	if err != nil {
+		return err
+	}
+	if !p.sameScope(parent) {
+		return errProjectScope
+	}
+
+	// The new parent must not be the project or be nested in it
+	for ancestor := parent; ; {
+		if ancestor.Id == p.Id {
+			return errProjectCycle
+		}
+		if len(ancestor.Parent) == 0 {
+			break
+		}
+		var next Project
+		if err = collection.FindId(ancestor.Parent).One(&next); err != nil {
+			return err
+		}
+		ancestor = &next
+	}
+
+	return collection.UpdateId(p.Id, bson.M{
+		"$set": bson.M{"parent": parent.Id},
+	})
+}
+
+// DeleteProject removes a project, its subprojects and translations moving
+// up to its parent
+func DeleteProject(mongoSession *mgo.Session, user bson.ObjectId, projectId string) error {
+	p, err := EditableProject(mongoSession, projectId, user)
+	if err != nil {
+		return err
+	}
+
+	parentUpdate := bson.M{"$unset": bson.M{"parent": ""}}
+	projectUpdate := bson.M{"$unset": bson.M{"project": ""}}
+	if len(p.Parent) > 0 {
+		parentUpdate = bson.M{"$set": bson.M{"parent": p.Parent}}
+		projectUpdate = bson.M{"$set": bson.M{"project": p.Parent}}
+	}
+
+	if _, err = mongoSession.DB(Database).C("projects").UpdateAll(bson.M{"parent": p.Id}, parentUpdate); err != nil {
+		return err
+	}
+	if _, err = mongoSession.DB(Database).C("translations").UpdateAll(bson.M{"project": p.Id}, projectUpdate); err != nil {
+		return err
+	}
+	return mongoSession.DB(Database).C("projects").RemoveId(p.Id)
+}
+
+// MoveTranslation puts t in the project projectId, or out of any project
+// when it is empty. Both its current and new projects must be editable by
+// user and be projects of the owner or of the team of t.
+func MoveTranslation(mongoSession *mgo.Session, t *Translation, user bson.ObjectId, projectId string) error {
+	// A project that no longer exists does not hold the translation
+	if len(t.Project) > 0 {
+		count, err := mongoSession.DB(Database).C("projects").FindId(t.Project).Count()
+		if err != nil {
+			return err
+		}
+		if _, editable, _ := findProject(mongoSession, t.Project.Hex(), user); count > 0 && !editable {
+			return ErrProjectForbidden
+		}
+	}
+
+	collection := mongoSession.DB(Database).C("translations")
+	if len(projectId) == 0 {
+		return collection.UpdateId(t.Id, bson.M{
+			"$unset": bson.M{"project": ""},
+		})
+	}
+
+	p, err := EditableProject(mongoSession, projectId, user)
+	if err != nil {
+		return err
+	}
+	if !p.holds(t) {
+		return errTranslationScope
+	}
+	return collection.UpdateId(t.Id, bson.M{
+		"$set": bson.M{"project": p.Id},
+	})
+}
+
+// normalizeTags trims, lowercases and sorts tags, without duplicates
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool)
+	normalized := make([]string, 0)
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if len(tag) == 0 || seen[tag] {
+			continue
+		}
+		if len(tag) > maxTagLength {
+			return nil, &errorString{"Tags are at most 50 characters long"}
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// SetTags replaces the tags of t
+func SetTags(mongoSession *mgo.Session, t *Translation, tags []string) ([]string, error) {
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	err = mongoSession.DB(Database).C("translations").UpdateId(t.Id, bson.M{
+		"$set": bson.M{"tags": tags, "updated_at": time.Now()},
+	})
+	return tags, err
+}
+
+// NewTranslationFilter filters on the project projectId, with its
+// subprojects, and on tag, when they are set
+func NewTranslationFilter(mongoSession *mgo.Session, user bson.ObjectId, projectId string, tag string) (*TranslationFilter, error) {
+	filter := TranslationFilter{Tag: strings.ToLower(strings.TrimSpace(tag))}
+	if len(projectId) == 0 {
+		return &filter, nil
+	}
+
+	root, _, err := findProject(mongoSession, projectId, user)
+	if err != nil {
+		return nil, err
+	}
+	projects, err := ListProjects(mongoSession, user)
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[bson.ObjectId][]bson.ObjectId)
+	for _, p := range projects {
+		if len(p.Parent) > 0 {
+			children[p.Parent] = append(children[p.Parent], p.Id)
+		}
+	}
+	queue := []bson.ObjectId{root.Id}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		filter.Projects = append(filter.Projects, id)
+		queue = append(queue, children[id]...)
+	}
+	return &filter, nil
+}
+
+// query is the filter as a translations query
+func (f *TranslationFilter) query() bson.M {
+	query := bson.M{}
+	if f == nil {
+		return query
+	}
+	if len(f.Projects) > 0 {
+		query["project"] = bson.M{"$in": f.Projects}
+	}
+	if len(f.Tag) > 0 {
+		query["tags"] = f.Tag
+	}
+	return query
+}
+
+// matches tells if a translation document passes the filter
+func (f *TranslationFilter) matches(t bson.M) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Projects) > 0 {
+		project, _ := t["project"].(bson.ObjectId)
+		found := false
+		for _, id := range f.Projects {
+			if id == project {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.Tag) > 0 {
+		tags, _ := t["tags"].([]interface{})
+		for _, tag := range tags {
+			if tag == f.Tag {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
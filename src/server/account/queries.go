@@ -4,37 +4,34 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
+	"time"
 )
 
-func FindSession(mongoSession *mgo.Session, id string) (*Session, error) {
+// CreateTranslation records the translation of upload, uploaded by oid
+func CreateTranslation(mongoSession *mgo.Session, upload Upload, oid bson.ObjectId) (*Translation, error) {
 	sessionCopy := mongoSession.Copy()
 	defer sessionCopy.Close()
-	collection := sessionCopy.DB("s2t").C("sessions")
-
-	_, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
-		return nil, err
-	}
-	oid := bson.ObjectIdHex(id)
-
-	var session Session
-	err = collection.Find(bson.M{"_id": oid}).One(&session)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return &session, nil
-}
-
-func CreateTranslation(mongoSession *mgo.Session, fileName string, oid bson.ObjectId) (*Translation, error) {
-	sessionCopy := mongoSession.Copy()
-	defer sessionCopy.Close()
-	collection := sessionCopy.DB("s2t").C("translations")
+	collection := sessionCopy.DB(Database).C("translations")
 
+	now := time.Now()
 	newTranslation := Translation{
-		FileName:    fileName,
+		Id:          bson.NewObjectId(),
+		FileName:    upload.FileName,
 		Transcripts: make([]Transcript, 0),
+		Status:      StatusReceiving,
+		Owner:       oid,
+		Acl: []Grant{
+			{User: oid, Access: AccessOwner},
+		},
+		CreatedAt:       &now,
+		UpdatedAt:       &now,
+		Uploader:        oid,
+		Size:            upload.Size,
+		Encoding:        upload.Encoding,
+		SampleRateHertz: upload.SampleRateHertz,
+		Language:        upload.Language,
+		Model:           upload.Model,
+		PacketSize:      upload.PacketSize,
 	}
 
 	err := collection.Insert(newTranslation)
@@ -43,13 +40,7 @@ func CreateTranslation(mongoSession *mgo.Session, fileName string, oid bson.Obje
 		return nil, err
 	}
 
-	err = collection.Find(newTranslation).One(&newTranslation)
-
-	if err != nil {
-		return nil, err
-	}
-
-	collection = sessionCopy.DB("s2t").C("accounts")
+	collection = sessionCopy.DB(Database).C("accounts")
 	query := bson.M{
 		"$push": bson.M{
 			"translations": newTranslation.Id,
@@ -65,23 +56,18 @@ func CreateTranslation(mongoSession *mgo.Session, fileName string, oid bson.Obje
 	return &newTranslation, nil
 }
 
-func FullAccount(mongoSession *mgo.Session, id string) (*bson.M, error) {
+// FullAccount returns the account of userId with its translations, listed
+// again in "owned" and "shared" depending on who owns them, and its teams
+// with their other translations in "team_translations". The lists are
+// restricted by filter, which may be nil.
+func FullAccount(mongoSession *mgo.Session, userId bson.ObjectId, filter *TranslationFilter) (*bson.M, error) {
 	sessionCopy := mongoSession.Copy()
 	defer sessionCopy.Close()
 
-	sessOid := bson.ObjectIdHex(id)
-	collection := sessionCopy.DB("s2t").C("sessions")
-	var sess Session
-	err := collection.FindId(sessOid).One(&sess)
-
-	if err != nil {
-		return nil, err
-	}
-
 	query := []bson.M{
 		{
 			"$match": bson.M{
-				"_id": sess.User,
+				"_id": userId,
 			},
 		},
 		{
@@ -92,42 +78,158 @@ func FullAccount(mongoSession *mgo.Session, id string) (*bson.M, error) {
 				"foreignField": "_id",
 			},
 		},
+		{
+			"$lookup": bson.M{
+				"from":         "teams",
+				"as":           "teams",
+				"localField":   "_id",
+				"foreignField": "members.user",
+			},
+		},
+		{
+			"$lookup": bson.M{
+				"from":         "translations",
+				"as":           "team_translations",
+				"localField":   "teams._id",
+				"foreignField": "team",
+			},
+		},
 		{
 			"$project": bson.M{
-				"translations.transcripts": 0,
-				"password":                 0,
+				"translations.transcripts":      0,
+				"translations.edited":           0,
+				"team_translations.transcripts": 0,
+				"team_translations.edited":      0,
+				"password":                      0,
+				"totp_secret":                   0,
+				"totp_pending":                  0,
+				"totp_last_step":                0,
+				"recovery_codes":                0,
 			},
 		},
 	}
 
-	collection = sessionCopy.DB("s2t").C("accounts")
+	collection := sessionCopy.DB(Database).C("accounts")
 	var a bson.M
-	err = collection.Pipe(query).One(&a)
+	err := collection.Pipe(query).One(&a)
 
 	if err != nil {
 		println(err.Error())
 		return nil, err
 	}
 
-	return &a, err
-}
+	// The role of the user in each of their teams
+	roles := make(map[bson.ObjectId]string)
+	teams, _ := a["teams"].([]interface{})
+	for _, item := range teams {
+		team, ok := item.(bson.M)
+		if !ok {
+			continue
+		}
+		id, _ := team["_id"].(bson.ObjectId)
+		members, _ := team["members"].([]interface{})
+		for _, m := range members {
+			if member, ok := m.(bson.M); ok && member["user"] == userId {
+				role, _ := member["role"].(string)
+				roles[id] = role
+				team["role"] = role
+			}
+		}
+	}
+
+	filtered := make([]bson.M, 0)
+	owned := make([]bson.M, 0)
+	shared := make([]bson.M, 0)
+	translations, _ := a["translations"].([]interface{})
+	for _, item := range translations {
+		t, ok := item.(bson.M)
+		if !ok || !filter.matches(t) {
+			continue
+		}
+		access := translationAccess(t, userId)
+		if team, ok := t["team"].(bson.ObjectId); ok && AccessAllows(TeamAccess(roles[team]), access) {
+			access = TeamAccess(roles[team])
+		}
+		t["access"] = access
+		filtered = append(filtered, t)
+		if access == AccessOwner {
+			owned = append(owned, t)
+		} else {
+			shared = append(shared, t)
+		}
+	}
+	a["translations"] = filtered
+	a["owned"] = owned
+	a["shared"] = shared
+
+	// Team translations are listed once, unless they are already among the
+	// personal ones
+	personal := make(map[bson.ObjectId]bool)
+	for _, item := range translations {
+		if t, ok := item.(bson.M); ok {
+			if id, ok := t["_id"].(bson.ObjectId); ok {
+				personal[id] = true
+			}
+		}
+	}
+
+	teamTranslations := make([]bson.M, 0)
+	items, _ := a["team_translations"].([]interface{})
+	for _, item := range items {
+		t, ok := item.(bson.M)
+		if !ok || !filter.matches(t) {
+			continue
+		}
+		if id, _ := t["_id"].(bson.ObjectId); personal[id] {
+			continue
+		}
+		team, _ := t["team"].(bson.ObjectId)
+		access := TeamAccess(roles[team])
+		if own := translationAccess(t, userId); AccessAllows(own, access) {
+			access = own
+		}
+		t["access"] = access
+		teamTranslations = append(teamTranslations, t)
+	}
+	a["team_translations"] = teamTranslations
+
+	projects, err := ListProjects(sessionCopy, userId)
+	if err != nil {
+		return nil, err
+	}
+	a["projects"] = projects
 
-func DeleteTranslation(mongoSession *mgo.Session, sess *Session, translationId *string) error {
-	collection := mongoSession.DB("s2t").C("translations")
-	oid := bson.ObjectIdHex(*translationId)
+	return &a, nil
+}
 
-	collection = mongoSession.DB("s2t").C("accounts")
-	err := collection.UpdateId(sess.User, bson.M{
+// DeleteTranslation removes a translation, its revisions, share links and
+// jobs, and every reference to it from the accounts
+func DeleteTranslation(mongoSession *mgo.Session, t *Translation) error {
+	_, err := mongoSession.DB(Database).C("accounts").UpdateAll(bson.M{
+		"translations": t.Id,
+	}, bson.M{
 		"$pull": bson.M{
-			"translations": oid,
+			"translations": t.Id,
 		},
 	})
 
-	return err
+	if err != nil {
+		return err
+	}
+
+	for _, collection := range []string{"revisions", "links", "jobs"} {
+		_, err = mongoSession.DB(Database).C(collection).RemoveAll(bson.M{"translation": t.Id})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return mongoSession.DB(Database).C("translations").RemoveId(t.Id)
 }
 
 func AllAccounts(mongoSession *mgo.Session) (accounts []Account, err error) {
-	collection := mongoSession.DB("s2t").C("accounts")
+	collection := mongoSession.DB(Database).C("accounts")
 	err = collection.Pipe([]bson.M{
 		{
 			"$match": &bson.M{},
@@ -142,26 +244,178 @@ func AllAccounts(mongoSession *mgo.Session) (accounts []Account, err error) {
 	return accounts, err
 }
 
-func ShareTranslation(mongoSession *mgo.Session, translationId *string, userId *string) (err error) {
-	collection := mongoSession.DB("s2t").C("accounts")
+// ShareTranslation grants access to t to the account userId and adds it to
+// their translations, replacing any previous grant
+func ShareTranslation(mongoSession *mgo.Session, t *Translation, userId *string, access string) (err error) {
+	if !ValidAccess(access) || access == AccessOwner {
+		return &errorString{"Invalid access, expected viewer or editor"}
+	}
 
 	_, err = primitive.ObjectIDFromHex(*userId)
 	if err != nil {
 		return err
 	}
-	_, err = primitive.ObjectIDFromHex(*translationId)
-	if err != nil {
-		return err
-	}
 	userOid := bson.ObjectIdHex(*userId)
-	translationOid := bson.ObjectIdHex(*userId)
 
+	if userOid == t.Owner {
+		return &errorString{"The owner already has access to this translation"}
+	}
+
+	collection := mongoSession.DB(Database).C("accounts")
 	err = collection.Update(bson.M{
 		"_id": userOid,
 	}, bson.M{
+		"$addToSet": bson.M{
+			"translations": t.Id,
+		},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	collection = mongoSession.DB(Database).C("translations")
+	err = collection.UpdateId(t.Id, bson.M{
+		"$pull": bson.M{
+			"acl": bson.M{"user": userOid},
+		},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return collection.UpdateId(t.Id, bson.M{
 		"$push": bson.M{
-			"translations": translationOid,
+			"acl": Grant{User: userOid, Access: access},
+		},
+	})
+}
+
+func GetTranslationStatus(t *Translation) *TranslationStatus {
+	status := TranslationStatus{
+		Id:          t.Id,
+		Status:      t.Status,
+		Progress:    t.Progress,
+		Error:       t.Error,
+		Transcripts: len(t.Transcripts),
+	}
+	// Translations created before statuses were recorded are finished
+	if len(status.Status) == 0 {
+		status.Status = StatusDone
+		status.Progress = 100
+	}
+	status.NoSpeech = status.Status == StatusDone && status.Transcripts == 0
+	return &status
+}
+
+// translationAccess reads the access of userId in a translation document
+func translationAccess(t bson.M, userId bson.ObjectId) string {
+	if owner, ok := t["owner"].(bson.ObjectId); ok && owner == userId {
+		return AccessOwner
+	}
+	acl, _ := t["acl"].([]interface{})
+	for _, item := range acl {
+		if grant, ok := item.(bson.M); ok && grant["user"] == userId {
+			if access, ok := grant["access"].(string); ok {
+				return access
+			}
+		}
+	}
+	return AccessNone
+}
+
+// Share is a grant along with the name of its account
+type Share struct {
+	User   bson.ObjectId `json:"user" bson:"_id"`
+	Name   string        `json:"name" bson:"name"`
+	Access string        `json:"access" bson:"-"`
+}
+
+// ListShares returns the accounts t is shared with, besides its owner
+func ListShares(mongoSession *mgo.Session, t *Translation) ([]Share, error) {
+	users := make([]bson.ObjectId, 0)
+	access := make(map[bson.ObjectId]string)
+	for _, grant := range t.Acl {
+		if grant.User == t.Owner {
+			continue
+		}
+		users = append(users, grant.User)
+		access[grant.User] = grant.Access
+	}
+
+	shares := make([]Share, 0)
+	err := mongoSession.DB(Database).C("accounts").Find(bson.M{
+		"_id": bson.M{"$in": users},
+	}).Select(bson.M{"name": 1}).Sort("name").All(&shares)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range shares {
+		shares[i].Access = access[shares[i].User]
+	}
+	return shares, nil
+}
+
+func parseGrantee(t *Translation, userId string) (bson.ObjectId, error) {
+	if !bson.IsObjectIdHex(userId) {
+		return "", &errorString{"Invalid account id"}
+	}
+	user := bson.ObjectIdHex(userId)
+	if user == t.Owner {
+		return "", &errorString{"The access of the owner cannot be changed"}
+	}
+	for _, grant := range t.Acl {
+		if grant.User == user {
+			return user, nil
+		}
+	}
+	return "", &errorString{"The translation is not shared with this account"}
+}
+
+// UpdateShare changes the access of an account the translation is shared with
+func UpdateShare(mongoSession *mgo.Session, t *Translation, userId string, access string) error {
+	if access != AccessViewer && access != AccessEditor {
+		return &errorString{"Invalid access, expected viewer or editor"}
+	}
+
+	user, err := parseGrantee(t, userId)
+	if err != nil {
+		return err
+	}
+
+	return mongoSession.DB(Database).C("translations").Update(bson.M{
+		"_id":      t.Id,
+		"acl.user": user,
+	}, bson.M{
+		"$set": bson.M{
+			"acl.$.access": access,
+		},
+	})
+}
+
+// RevokeShare removes the access of an account and the translation from it
+func RevokeShare(mongoSession *mgo.Session, t *Translation, userId string) error {
+	user, err := parseGrantee(t, userId)
+	if err != nil {
+		return err
+	}
+
+	err = mongoSession.DB(Database).C("translations").UpdateId(t.Id, bson.M{
+		"$pull": bson.M{
+			"acl": bson.M{"user": user},
+		},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return mongoSession.DB(Database).C("accounts").UpdateId(user, bson.M{
+		"$pull": bson.M{
+			"translations": t.Id,
 		},
 	})
-	return err
 }
@@ -0,0 +1,274 @@
+package account
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"time"
+)
+
+var (
+	ErrConflict = errors.New("translation was modified meanwhile, retry")
+	// ErrNotRecognized refuses edits before the machine output is final,
+	// which they would hide
+	ErrNotRecognized = errors.New("translation can only be edited once recognized")
+)
+
+// Edit changes one word of a transcript, or the whole transcript when Word is
+// not set. Fields left empty are not changed.
+type Edit struct {
+	Transcript int            `json:"transcript" bson:"transcript"`
+	Word       *int           `json:"word,omitempty" bson:"word,omitempty"`
+	Text       *string        `json:"text,omitempty" bson:"text,omitempty"`
+	StartTime  *ResultEndTime `json:"starttime,omitempty" bson:"starttime,omitempty"`
+	EndTime    *ResultEndTime `json:"endtime,omitempty" bson:"endtime,omitempty"`
+	SpeakerTag *int8          `json:"speakertag,omitempty" bson:"speakertag,omitempty"`
+}
+
+// Revision is one saved state of the edited transcripts of a translation,
+// revision 0 being the machine output kept in Translation.Transcripts
+type Revision struct {
+	Id          bson.ObjectId `json:"_id" bson:"_id,omitempty"`
+	Translation bson.ObjectId `json:"translation" bson:"translation"`
+	Number      int           `json:"number" bson:"number"`
+	Author      bson.ObjectId `json:"author" bson:"author"`
+	CreatedAt   time.Time     `json:"created_at" bson:"created_at"`
+	Edits       []Edit        `json:"edits,omitempty" bson:"edits,omitempty"`
+	RevertedTo  *int          `json:"reverted_to,omitempty" bson:"reverted_to,omitempty"`
+	Note        string        `json:"note,omitempty" bson:"note,omitempty"`
+	Transcripts []Transcript  `json:"transcripts,omitempty" bson:"transcripts"`
+}
+
+// CurrentTranscripts are the edited transcripts, or the machine output when
+// the translation was never edited
+func (t *Translation) CurrentTranscripts() []Transcript {
+	if t.Revision > 0 {
+		return t.Edited
+	}
+	return t.Transcripts
+}
+
+func copyTranscripts(transcripts []Transcript) []Transcript {
+	copied := make([]Transcript, len(transcripts))
+	for i, transcript := range transcripts {
+		copied[i] = transcript
+		copied[i].Alternatives = make([]Alternative, len(transcript.Alternatives))
+		for j, alt := range transcript.Alternatives {
+			copied[i].Alternatives[j] = alt
+			copied[i].Alternatives[j].Words = append([]Word{}, alt.Words...)
+		}
+	}
+	return copied
+}
+
+func joinWords(words []Word) string {
+	texts := make([]string, len(words))
+	for i, word := range words {
+		texts[i] = word.Word
+	}
+	return strings.Join(texts, " ")
+}
+
+// applyEdit changes the best alternative of the edited transcript
+func applyEdit(transcripts []Transcript, edit Edit) error {
+	if edit.Transcript < 0 || edit.Transcript >= len(transcripts) || len(transcripts[edit.Transcript].Alternatives) == 0 {
+		return fmt.Errorf("no transcript %d", edit.Transcript)
+	}
+	alt := &transcripts[edit.Transcript].Alternatives[0]
+
+	if edit.Word != nil {
+		if *edit.Word < 0 || *edit.Word >= len(alt.Words) {
+			return fmt.Errorf("no word %d in transcript %d", *edit.Word, edit.Transcript)
+		}
+		word := &alt.Words[*edit.Word]
+		if edit.Text != nil {
+			word.Word = strings.TrimSpace(*edit.Text)
+		}
+		if edit.StartTime != nil {
+			word.StartTime = *edit.StartTime
+		}
+		if edit.EndTime != nil {
+			word.EndTime = *edit.EndTime
+		}
+		if edit.SpeakerTag != nil {
+			word.SpeakerTag = *edit.SpeakerTag
+		}
+		if word.EndTime.Duration() < word.StartTime.Duration() {
+			return fmt.Errorf("word %d of transcript %d ends before it starts", *edit.Word, edit.Transcript)
+		}
+		alt.Transcript = joinWords(alt.Words)
+		return nil
+	}
+
+	if edit.Text != nil {
+		alt.Words = retimeWords(alt.Words, *edit.Text)
+		alt.Transcript = strings.TrimSpace(*edit.Text)
+	}
+	if len(alt.Words) > 0 {
+		if edit.StartTime != nil {
+			alt.Words[0].StartTime = *edit.StartTime
+		}
+		if edit.EndTime != nil {
+			alt.Words[len(alt.Words)-1].EndTime = *edit.EndTime
+		}
+	}
+	if edit.SpeakerTag != nil {
+		for i := range alt.Words {
+			alt.Words[i].SpeakerTag = *edit.SpeakerTag
+		}
+	}
+	return nil
+}
+
+// retimeWords replaces the words of a segment by those of text, keeping the
+// timings when the number of words is unchanged and spreading them evenly
+// over the segment otherwise
+func retimeWords(words []Word, text string) []Word {
+	fields := strings.Fields(text)
+	if len(fields) == len(words) {
+		retimed := append([]Word{}, words...)
+		for i, field := range fields {
+			retimed[i].Word = field
+		}
+		return retimed
+	}
+
+	retimed := make([]Word, len(fields))
+	if len(words) == 0 {
+		for i, field := range fields {
+			retimed[i] = Word{Word: field}
+		}
+		return retimed
+	}
+
+	start := words[0].StartTime.Duration()
+	step := (words[len(words)-1].EndTime.Duration() - start) / time.Duration(len(fields))
+	for i, field := range fields {
+		retimed[i] = Word{
+			StartTime:  durationToTime(start + time.Duration(i)*step),
+			EndTime:    durationToTime(start + time.Duration(i+1)*step),
+			Word:       field,
+			SpeakerTag: words[0].SpeakerTag,
+		}
+	}
+	return retimed
+}
+
+func durationToTime(d time.Duration) ResultEndTime {
+	return ResultEndTime{
+		Seconds: int64(d / time.Second),
+		Nanos:   int32(d % time.Second),
+	}
+}
+
+func findTranslation(mongoSession *mgo.Session, translationId string) (*Translation, error) {
+	if !bson.IsObjectIdHex(translationId) {
+		return nil, &errorString{"Invalid translation id"}
+	}
+	var t Translation
+	err := mongoSession.DB(Database).C("translations").FindId(bson.ObjectIdHex(translationId)).One(&t)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// saveRevision stores transcripts as the next revision of t, failing with
+// ErrConflict if another revision was saved since t was read. The revision
+// is inserted first and removed again when the translation cannot follow,
+// so that no edited transcripts lack their revision.
+func saveRevision(mongoSession *mgo.Session, t *Translation, revision Revision) (*Revision, error) {
+	// Translations created before statuses were recorded are recognized
+	if len(t.Status) > 0 && t.Status != StatusDone {
+		return nil, ErrNotRecognized
+	}
+
+	revisions := mongoSession.DB(Database).C("revisions")
+
+	revision.Id = bson.NewObjectId()
+	revision.Translation = t.Id
+	revision.Number = t.Revision + 1
+	revision.CreatedAt = time.Now()
+
+	if err := revisions.Insert(&revision); err != nil {
+		return nil, err
+	}
+
+	err := mongoSession.DB(Database).C("translations").Update(bson.M{
+		"_id":      t.Id,
+		"revision": bson.M{"$in": []interface{}{t.Revision, nil}},
+		"status":   bson.M{"$in": []interface{}{StatusDone, nil}},
+	}, bson.M{
+		"$set": bson.M{
+			"edited":     revision.Transcripts,
+			"revision":   revision.Number,
+			"updated_at": time.Now(),
+		},
+	})
+	if err != nil {
+		if removeErr := revisions.RemoveId(revision.Id); removeErr != nil {
+			return nil, removeErr
+		}
+		if err == mgo.ErrNotFound {
+			return nil, ErrConflict
+		}
+		return nil, err
+	}
+	return &revision, nil
+}
+
+func EditTranslation(mongoSession *mgo.Session, t *Translation, author bson.ObjectId, edits []Edit) (*Revision, error) {
+	if len(edits) == 0 {
+		return nil, &errorString{"No edits"}
+	}
+
+	transcripts := copyTranscripts(t.CurrentTranscripts())
+	for _, edit := range edits {
+		if err := applyEdit(transcripts, edit); err != nil {
+			return nil, err
+		}
+	}
+
+	return saveRevision(mongoSession, t, Revision{
+		Author:      author,
+		Edits:       edits,
+		Transcripts: transcripts,
+	})
+}
+
+// RevertTranslation saves a new revision with the transcripts of an earlier
+// one, 0 restoring the machine output
+func RevertTranslation(mongoSession *mgo.Session, t *Translation, author bson.ObjectId, number int) (*Revision, error) {
+	if number < 0 || number >= t.Revision {
+		return nil, fmt.Errorf("cannot revert to revision %d", number)
+	}
+
+	transcripts := t.Transcripts
+	if number > 0 {
+		var earlier Revision
+		err := mongoSession.DB(Database).C("revisions").Find(bson.M{
+			"translation": t.Id,
+			"number":      number,
+		}).One(&earlier)
+		if err != nil {
+			return nil, err
+		}
+		transcripts = earlier.Transcripts
+	}
+
+	return saveRevision(mongoSession, t, Revision{
+		Author:      author,
+		RevertedTo:  &number,
+		Transcripts: transcripts,
+	})
+}
+
+// ListRevisions returns the revisions of a translation without their transcripts
+func ListRevisions(mongoSession *mgo.Session, t *Translation) (revisions []Revision, err error) {
+	err = mongoSession.DB(Database).C("revisions").Find(bson.M{
+		"translation": t.Id,
+	}).Select(bson.M{"transcripts": 0}).Sort("number").All(&revisions)
+	return revisions, err
+}
@@ -0,0 +1,179 @@
+package account
+
+import (
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"log"
+)
+
+// Roles of an account, each one including the ones before
+const (
+	RoleGuest  = "guest"
+	RoleMember = "member"
+	RoleAdmin  = "admin"
+)
+
+var roleRanks = map[string]int{
+	RoleGuest:  1,
+	RoleMember: 2,
+	RoleAdmin:  3,
+}
+
+var (
+	ErrAccountDisabled   = errors.New("This account is disabled")
+	ErrNotAllowed        = errors.New("Your role does not allow this")
+	errInvalidRole       = errors.New("Invalid role, expected admin, member or guest")
+	errDirectoryPassword = errors.New("The password of directory accounts is changed in the directory")
+	errSelfAdmin         = errors.New("You cannot change your own role or disable your own account")
+)
+
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// EffectiveRole is the role of the account, accounts created before roles
+// existing being members
+func (a *Account) EffectiveRole() string {
+	if len(a.Role) == 0 {
+		return RoleMember
+	}
+	return a.Role
+}
+
+// HasRole tells whether the account is enabled and its role at least role
+func (a *Account) HasRole(role string) bool {
+	return !a.Disabled && roleRanks[a.EffectiveRole()] >= roleRanks[role]
+}
+
+func FindAccount(mongoSession *mgo.Session, id bson.ObjectId) (*Account, error) {
+	var a Account
+	err := mongoSession.DB(Database).C("accounts").FindId(id).One(&a)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func parseAccountId(userId string) (bson.ObjectId, error) {
+	if !bson.IsObjectIdHex(userId) {
+		return "", &errorString{"Invalid account id"}
+	}
+	return bson.ObjectIdHex(userId), nil
+}
+
+// SetAccountDisabled disables or enables an account, ending its sessions
+// when disabled
+func SetAccountDisabled(mongoSession *mgo.Session, admin bson.ObjectId, userId string, disabled bool) error {
+	user, err := parseAccountId(userId)
+	if err != nil {
+		return err
+	}
+	if user == admin {
+		return errSelfAdmin
+	}
+
+	err = mongoSession.DB(Database).C("accounts").UpdateId(user, bson.M{
+		"$set": bson.M{"disabled": disabled},
+	})
+	if err != nil || !disabled {
+		return err
+	}
+
+	_, err = mongoSession.DB(Database).C("sessions").RemoveAll(bson.M{"user": user})
+	return err
+}
+
+func SetAccountRole(mongoSession *mgo.Session, admin bson.ObjectId, userId string, role string) error {
+	if !ValidRole(role) {
+		return errInvalidRole
+	}
+	user, err := parseAccountId(userId)
+	if err != nil {
+		return err
+	}
+	if user == admin {
+		return errSelfAdmin
+	}
+
+	return mongoSession.DB(Database).C("accounts").UpdateId(user, bson.M{
+		"$set": bson.M{"role": role},
+	})
+}
+
+// ResetPassword sets a new password for an account and ends its sessions
+// and API keys
+func ResetPassword(mongoSession *mgo.Session, userId string, password string) error {
+	user, err := parseAccountId(userId)
+	if err != nil {
+		return err
+	}
+	if len(password) == 0 {
+		return &errorString{"Missing password"}
+	}
+
+	a, err := FindAccount(mongoSession, user)
+	if err != nil {
+		return err
+	}
+	if a.Source == SourceLdap {
+		return errDirectoryPassword
+	}
+
+	bytesHash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return err
+	}
+
+	err = mongoSession.DB(Database).C("accounts").UpdateId(user, bson.M{
+		"$set": bson.M{"password": string(bytesHash)},
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err = mongoSession.DB(Database).C("sessions").RemoveAll(bson.M{"user": user}); err != nil {
+		return err
+	}
+	_, err = mongoSession.DB(Database).C("apikeys").RemoveAll(bson.M{"user": user})
+	return err
+}
+
+// BootstrapAdmin makes sure an admin exists when none does, promoting the
+// account called name or creating it with password
+func BootstrapAdmin(mongoSession *mgo.Session, name string, password string) error {
+	if len(name) == 0 {
+		return nil
+	}
+
+	sessionCopy := mongoSession.Copy()
+	defer sessionCopy.Close()
+	collection := sessionCopy.DB(Database).C("accounts")
+
+	count, err := collection.Find(bson.M{"role": RoleAdmin}).Count()
+	if err != nil || count > 0 {
+		return err
+	}
+
+	err = collection.Update(bson.M{"name": name}, bson.M{
+		"$set": bson.M{"role": RoleAdmin, "disabled": false},
+	})
+	if err == nil {
+		log.Printf("promoted account %s to admin", name)
+		return nil
+	}
+	if err != mgo.ErrNotFound {
+		return err
+	}
+
+	if len(password) == 0 {
+		return &errorString{"ADMIN_PASSWORD must be set to create the first admin"}
+	}
+	err = CreateAccount(&Account{Name: name, Password: password, Role: RoleAdmin}, sessionCopy)
+	if err == nil {
+		log.Printf("created admin account %s", name)
+	}
+	return err
+}
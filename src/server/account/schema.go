@@ -1,6 +1,7 @@
 package account
 
 import (
+	"github.com/golang/protobuf/ptypes/duration"
 	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
 	"gopkg.in/mgo.v2/bson"
 	"time"
@@ -11,11 +12,25 @@ type ResultEndTime struct {
 	Seconds int64 `json:"seconds" bson:"seconds"`
 }
 
+func (t ResultEndTime) Duration() time.Duration {
+	return time.Duration(t.Seconds)*time.Second + time.Duration(t.Nanos)
+}
+
+func durationFromProto(d *duration.Duration) ResultEndTime {
+	return ResultEndTime{
+		Nanos:   d.GetNanos(),
+		Seconds: d.GetSeconds(),
+	}
+}
+
 type Word struct {
 	StartTime  ResultEndTime `json:"starttime" bson:"starttime"`
 	EndTime    ResultEndTime `json:"endtime" bson:"endtime"`
 	Word       string        `json:"word" bson:"word"`
+	Confidence float32       `json:"confidence" bson:"confidence"`
 	SpeakerTag int8          `json:"speakertag" bson:"speakertag"`
+	// Speaker is the name of SpeakerTag, filled by Translation.ApplySpeakers
+	Speaker string `json:"speaker,omitempty" bson:"-"`
 }
 
 type Alternative struct {
@@ -24,38 +39,163 @@ type Alternative struct {
 	Words      []Word  `json:"words" bson:"words"`
 }
 
+// Transcript is one recognition result. The bson names are the ones Google's
+// results were stored with before being normalized, so older documents still
+// decode.
 type Transcript struct {
-	Alternatives []Alternative `json:"alternatives" bson:"alternatives"`
+	Alternatives  []Alternative `json:"alternatives" bson:"alternatives"`
+	ChannelTag    int32         `json:"channeltag" bson:"channeltag"`
+	ResultEndTime ResultEndTime `json:"resultendtime" bson:"resultendtime"`
+	LanguageCode  string        `json:"languagecode" bson:"languagecode"`
 }
 
+// TranscriptFromResult converts a result of Google's v1 API. That version
+// reports neither word confidence, result end time nor language, Normalize
+// fills the last two.
 func TranscriptFromResult(result *speechpb.SpeechRecognitionResult) Transcript {
 	alternatives := make([]Alternative, len(result.Alternatives))
 	for i, alt := range result.Alternatives {
+		words := make([]Word, len(alt.Words))
+		for j, word := range alt.Words {
+			words[j] = Word{
+				StartTime:  durationFromProto(word.StartTime),
+				EndTime:    durationFromProto(word.EndTime),
+				Word:       word.Word,
+				SpeakerTag: int8(word.SpeakerTag),
+			}
+		}
 		alternatives[i] = Alternative{
 			Confidence: alt.Confidence,
 			Transcript: alt.Transcript,
+			Words:      words,
 		}
 	}
 	return Transcript{
 		Alternatives: alternatives,
+		ChannelTag:   result.ChannelTag,
+	}
+}
+
+func (t *Transcript) lastWordEnd() ResultEndTime {
+	var end ResultEndTime
+	for _, alt := range t.Alternatives {
+		if len(alt.Words) > 0 && alt.Words[len(alt.Words)-1].EndTime.Duration() > end.Duration() {
+			end = alt.Words[len(alt.Words)-1].EndTime
+		}
+	}
+	return end
+}
+
+// Normalize fills the fields an engine did not report, the language being
+// the one requested and the end the one of the last word
+func (t *Transcript) Normalize(languageCode string) {
+	if len(t.LanguageCode) == 0 {
+		t.LanguageCode = languageCode
+	}
+	if t.ResultEndTime.Duration() == 0 {
+		t.ResultEndTime = t.lastWordEnd()
 	}
 }
 
+// Status of a translation, mirroring the state of its transcription job
+const (
+	StatusReceiving   = "receiving"
+	StatusUploaded    = "uploaded"
+	StatusRecognizing = "recognizing"
+	StatusDone        = "done"
+	StatusFailed      = "failed"
+)
+
 type Translation struct {
 	Id          bson.ObjectId `json:"_id" bson:"_id,omitempty"`
 	FileName    string        `json:"file_name" bson:"file_name"`
 	Transcripts []Transcript  `json:"transcripts" bson:"transcripts"`
+	Status      string        `json:"status" bson:"status,omitempty"`
+	Progress    int32         `json:"progress" bson:"progress"`
+	Error       string        `json:"error,omitempty" bson:"error,omitempty"`
+	Edited      []Transcript  `json:"edited,omitempty" bson:"edited,omitempty"`
+	Revision    int           `json:"revision" bson:"revision"`
+	Speakers    []Speaker     `json:"speakers" bson:"speakers,omitempty"`
+	Owner       bson.ObjectId `json:"owner,omitempty" bson:"owner,omitempty"`
+	Acl         []Grant       `json:"acl" bson:"acl,omitempty"`
+	// Team whose members can access the translation
+	Team bson.ObjectId `json:"team,omitempty" bson:"team,omitempty"`
+	// Project the translation is filed in
+	Project bson.ObjectId `json:"project,omitempty" bson:"project,omitempty"`
+	Tags    []string      `json:"tags,omitempty" bson:"tags,omitempty"`
+	// Audio is the name of the uploaded file in the blob store, when kept
+	Audio string `json:"audio,omitempty" bson:"audio,omitempty"`
+	// Times of the upload and of the last change of the transcripts,
+	// speakers, tags or metadata
+	CreatedAt *time.Time    `json:"created_at,omitempty" bson:"created_at,omitempty"`
+	UpdatedAt *time.Time    `json:"updated_at,omitempty" bson:"updated_at,omitempty"`
+	Uploader  bson.ObjectId `json:"uploader,omitempty" bson:"uploader,omitempty"`
+	// Size of the upload in bytes and duration of the speech in seconds
+	Size     int64   `json:"size,omitempty" bson:"size,omitempty"`
+	Duration float64 `json:"duration,omitempty" bson:"duration,omitempty"`
+	// Settings the audio was recognized with
+	Encoding        string `json:"encoding,omitempty" bson:"encoding,omitempty"`
+	SampleRateHertz int32  `json:"sample_rate_hertz,omitempty" bson:"sample_rate_hertz,omitempty"`
+	Language        string `json:"language,omitempty" bson:"language,omitempty"`
+	Model           string `json:"model,omitempty" bson:"model,omitempty"`
+	PacketSize      int    `json:"packet_size,omitempty" bson:"packet_size,omitempty"`
+	// Metadata edited by the users
+	Title       string `json:"title,omitempty" bson:"title,omitempty"`
+	Description string `json:"description,omitempty" bson:"description,omitempty"`
+	Notes       string `json:"notes,omitempty" bson:"notes,omitempty"`
 }
 
-type Account struct {
-	Id           bson.ObjectId `json:"_id" bson:"_id,omitempty"`
-	Name         string        `json:"name" bson:"name"`
-	Password     string        `json:"password" bson:"password"`
-	Translations []Translation `json:"translations" bson:"translations"`
+// Upload describes the audio a translation is created for and how it is
+// to be recognized
+type Upload struct {
+	FileName        string
+	Size            int64
+	Encoding        string
+	SampleRateHertz int32
+	Language        string
+	Model           string
+	PacketSize      int
+}
+
+// SpeechDuration is the end of the last transcript, in seconds
+func SpeechDuration(transcripts []Transcript) float64 {
+	var end time.Duration
+	for _, t := range transcripts {
+		if d := t.ResultEndTime.Duration(); d > end {
+			end = d
+		}
+	}
+	return end.Seconds()
 }
 
-type Session struct {
-	Id        bson.ObjectId `json:"_id" bson:"_id,omitempty"`
-	User      bson.ObjectId
-	CreatedAt time.Time `json:"created_at,omitempty" bson:"created_at,omitempty"`
+// TranslationStatus is the answer of /translations/status
+type TranslationStatus struct {
+	Id          bson.ObjectId `json:"_id"`
+	Status      string        `json:"status"`
+	Progress    int32         `json:"progress"`
+	Error       string        `json:"error,omitempty"`
+	Transcripts int           `json:"transcripts"`
+	NoSpeech    bool          `json:"noSpeech"`
+}
+
+type Account struct {
+	Id           bson.ObjectId   `json:"_id" bson:"_id,omitempty"`
+	Name         string          `json:"name" bson:"name"`
+	Password     string          `json:"password" bson:"password"`
+	Email        string          `json:"email,omitempty" bson:"email,omitempty"`
+	Translations []bson.ObjectId `json:"translations" bson:"translations"`
+	Role         string          `json:"role" bson:"role,omitempty"`
+	Disabled     bool            `json:"disabled" bson:"disabled"`
+	// Source is ldap or oidc for accounts created by these logins, empty
+	// for local ones
+	Source string `json:"source,omitempty" bson:"source,omitempty"`
+	// Oidc is the identity provider user the account is linked to
+	Oidc *OidcIdentity `json:"oidc,omitempty" bson:"oidc,omitempty"`
+	// TotpEnabled accounts log in with a code of TotpSecret or one of their
+	// hashed RecoveryCodes after their password
+	TotpEnabled   bool     `json:"totp_enabled" bson:"totp_enabled,omitempty"`
+	TotpSecret    string   `json:"-" bson:"totp_secret,omitempty"`
+	TotpPending   string   `json:"-" bson:"totp_pending,omitempty"`
+	TotpLastStep  int64    `json:"-" bson:"totp_last_step,omitempty"`
+	RecoveryCodes []string `json:"-" bson:"recovery_codes,omitempty"`
 }
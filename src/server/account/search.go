@@ -0,0 +1,169 @@
+package account
+
+import (
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"unicode"
+)
+
+// Words shown around a match in a search snippet
+const snippetContext = 6
+
+type SearchHit struct {
+	TranslationId bson.ObjectId `json:"translationId"`
+	FileName      string        `json:"file_name"`
+	Transcript    int           `json:"transcript"`
+	Word          int           `json:"word"`
+	Snippet       string        `json:"snippet"`
+	StartTime     ResultEndTime `json:"starttime"`
+	EndTime       ResultEndTime `json:"endtime"`
+	SpeakerTag    int8          `json:"speakertag"`
+	Speaker       string        `json:"speaker,omitempty"`
+}
+
+// ensureSearchIndexes creates the text index of the transcripts.
+// Transcripts are in many languages, so words are indexed as they are. The
+// override field is renamed so that a "language" field is not taken for the
+// language of the document.
+func ensureSearchIndexes(mongoSession *mgo.Session) error {
+	return mongoSession.DB(Database).C("translations").EnsureIndex(mgo.Index{
+		Key: []string{
+			"$text:transcripts.alternatives.transcript",
+			"$text:edited.alternatives.transcript",
+		},
+		Name:             "transcripts_text",
+		DefaultLanguage:  "none",
+		LanguageOverride: "text_language",
+	})
+}
+
+func normalizeSearchWord(word string) string {
+	return strings.ToLower(strings.TrimFunc(word, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}))
+}
+
+// searchTerms are the words of a text query, without negated ones
+func searchTerms(query string) []string {
+	terms := make([]string, 0)
+	for _, field := range strings.Fields(query) {
+		if strings.HasPrefix(field, "-") {
+			continue
+		}
+		if term := normalizeSearchWord(field); len(term) > 0 {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+func matchesTerm(word string, terms []string) bool {
+	word = normalizeSearchWord(word)
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+	}
+	return false
+}
+
+func snippet(words []Word, index int) string {
+	from := index - snippetContext
+	if from < 0 {
+		from = 0
+	}
+	to := index + snippetContext + 1
+	if to > len(words) {
+		to = len(words)
+	}
+	return joinWords(words[from:to])
+}
+
+// transcriptHits finds the matching words of the current transcripts of t,
+// among the results listed by TranscriptWords
+func transcriptHits(t *Translation, terms []string) []SearchHit {
+	hits := make([]SearchHit, 0)
+	transcripts := t.CurrentTranscripts()
+	for i := wordResults(transcripts); i < len(transcripts); i++ {
+		transcript := transcripts[i]
+		if len(transcript.Alternatives) == 0 {
+			continue
+		}
+		words := transcript.Alternatives[0].Words
+		for j, word := range words {
+			if !matchesTerm(word.Word, terms) {
+				continue
+			}
+			hit := SearchHit{
+				TranslationId: t.Id,
+				FileName:      t.FileName,
+				Transcript:    i,
+				Word:          j,
+				Snippet:       snippet(words, j),
+				StartTime:     word.StartTime,
+				EndTime:       word.EndTime,
+				SpeakerTag:    word.SpeakerTag,
+			}
+			if word.SpeakerTag != 0 {
+				hit.Speaker = t.SpeakerName(word.SpeakerTag)
+			}
+			hits = append(hits, hit)
+		}
+	}
+	return hits
+}
+
+// SearchTranslations looks for query in the translations of the account of
+// userId, best matching translations first
+func SearchTranslations(mongoSession *mgo.Session, userId bson.ObjectId, query string, filter *TranslationFilter, limit int) ([]SearchHit, error) {
+	hits := make([]SearchHit, 0)
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return hits, nil
+	}
+
+	var a Account
+	err := mongoSession.DB(Database).C("accounts").FindId(userId).Select(bson.M{"translations": 1}).One(&a)
+	if err != nil {
+		return nil, err
+	}
+
+	// $text cannot be in an $or with the team condition, so team
+	// translations are found first
+	teams, err := TeamIds(mongoSession, userId)
+	if err != nil {
+		return nil, err
+	}
+	var teamTranslations []Translation
+	err = mongoSession.DB(Database).C("translations").Find(bson.M{
+		"team": bson.M{"$in": teams},
+	}).Select(bson.M{"_id": 1}).All(&teamTranslations)
+	if err != nil {
+		return nil, err
+	}
+	ids := a.Translations
+	for _, t := range teamTranslations {
+		ids = append(ids, t.Id)
+	}
+
+	selector := filter.query()
+	selector["_id"] = bson.M{"$in": ids}
+	selector["$text"] = bson.M{"$search": query}
+
+	var translations []Translation
+	err = mongoSession.DB(Database).C("translations").Find(selector).Select(bson.M{
+		"score": bson.M{"$meta": "textScore"},
+	}).Sort("$textScore:score").All(&translations)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range translations {
+		hits = append(hits, transcriptHits(&translations[i], terms)...)
+		if limit > 0 && len(hits) >= limit {
+			return hits[:limit], nil
+		}
+	}
+	return hits, nil
+}
@@ -0,0 +1,43 @@
+package account
+
+import "testing"
+
+func TestTranscriptHits(t *testing.T) {
+	tests := []struct {
+		name        string
+		transcripts []Transcript
+		want        []int
+	}{
+		{
+			name: "every result",
+			transcripts: []Transcript{
+				result(word("hello", 0, 0), word("world", 1, 0)),
+				result(word("hello", 2, 0)),
+			},
+			want: []int{0, 1},
+		},
+		{
+			name: "diarization summary only",
+			transcripts: []Transcript{
+				result(word("hello", 0, 0), word("world", 1, 0)),
+				result(word("hello", 2, 0)),
+				result(word("hello", 0, 1), word("world", 1, 1), word("hello", 2, 2)),
+			},
+			want: []int{2, 2},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hits := transcriptHits(&Translation{Transcripts: test.transcripts}, searchTerms("hello"))
+			if len(hits) != len(test.want) {
+				t.Fatalf("got %d hits, want %d", len(hits), len(test.want))
+			}
+			for i, hit := range hits {
+				if hit.Transcript != test.want[i] {
+					t.Errorf("hit %d in transcript %d, want %d", i, hit.Transcript, test.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package account
+
+import (
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"time"
+)
+
+// Session is a login of a user. The token given to the client is only
+// stored hashed.
+type Session struct {
+	Id        bson.ObjectId `json:"_id" bson:"_id,omitempty"`
+	TokenHash string        `json:"-" bson:"token_hash"`
+	User      bson.ObjectId `json:"User" bson:"user"`
+	CreatedAt time.Time     `json:"created_at,omitempty" bson:"created_at,omitempty"`
+	LastSeen  time.Time     `json:"last_seen" bson:"last_seen"`
+	// ExpiresAt is the earliest of the idle and absolute expiries, sessions
+	// are purged by a TTL index on it
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+	UserAgent string    `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	Ip        string    `json:"ip,omitempty" bson:"ip,omitempty"`
+	// ApiKey is set on the sessions standing for a request made with an
+	// API key, which are not stored
+	ApiKey bson.ObjectId `json:"api_key,omitempty" bson:"-"`
+}
+
+// LoginResponse carries a new session token. The token is also sent as _id
+// for clients that used the session id as token.
+type LoginResponse struct {
+	Id        string        `json:"_id"`
+	Token     string        `json:"token"`
+	User      bson.ObjectId `json:"User"`
+	CreatedAt time.Time     `json:"created_at"`
+	ExpiresAt time.Time     `json:"expires_at"`
+}
+
+// SessionInfo describes an active session to its user
+type SessionInfo struct {
+	Session
+	Current bool `json:"current"`
+}
+
+var (
+	// SessionIdleTimeout ends sessions unused for that long
+	SessionIdleTimeout = 24 * time.Hour
+	// SessionMaxLifetime ends sessions that old, even when used
+	SessionMaxLifetime = 7 * 24 * time.Hour
+)
+
+// Sessions are only saved as seen once per touchInterval
+const touchInterval = time.Minute
+
+var errInvalidSession = &errorString{"Invalid or expired session"}
+
+func (s *Session) expiry(lastSeen time.Time) time.Time {
+	idle := lastSeen.Add(SessionIdleTimeout)
+	absolute := s.CreatedAt.Add(SessionMaxLifetime)
+	if idle.Before(absolute) {
+		return idle
+	}
+	return absolute
+}
+
+func (s *Session) response(token string) *LoginResponse {
+	return &LoginResponse{
+		Id:        token,
+		Token:     token,
+		User:      s.User,
+		CreatedAt: s.CreatedAt,
+		ExpiresAt: s.ExpiresAt,
+	}
+}
+
+func ensureSessionIndexes(mongoSession *mgo.Session) error {
+	collection := mongoSession.DB(Database).C("sessions")
+
+	// Sessions from before tokens were hashed cannot be checked and would
+	// never expire, so their users log in again
+	_, err := collection.RemoveAll(bson.M{
+		"$or": []bson.M{
+			{"token_hash": bson.M{"$exists": false}},
+			{"expires_at": bson.M{"$exists": false}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = collection.EnsureIndex(mgo.Index{
+		Key:    []string{"token_hash"},
+		Unique: true,
+		Sparse: true,
+	})
+	if err != nil {
+		return err
+	}
+	return collection.EnsureIndex(mgo.Index{
+		Key:         []string{"expires_at"},
+		ExpireAfter: time.Second,
+	})
+}
+
+// CreateSession starts a session for the account id and returns its token
+func CreateSession(id bson.ObjectId, sessionCopy *mgo.Session, userAgent string, ip string) (*LoginResponse, error) {
+	collection := sessionCopy.DB(Database).C("sessions")
+
+	token, err := RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := Session{
+		Id:        bson.NewObjectId(),
+		TokenHash: HashToken(token),
+		User:      id,
+		CreatedAt: now,
+		LastSeen:  now,
+		UserAgent: userAgent,
+		Ip:        ip,
+	}
+	session.ExpiresAt = session.expiry(now)
+
+	err = collection.Insert(&session)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return session.response(token), nil
+}
+
+// FindSession returns the unexpired session of token
+func FindSession(mongoSession *mgo.Session, token string) (*Session, error) {
+	sessionCopy := mongoSession.Copy()
+	defer sessionCopy.Close()
+	collection := sessionCopy.DB(Database).C("sessions")
+
+	if len(token) == 0 {
+		return nil, errInvalidSession
+	}
+
+	var session Session
+	err := collection.Find(bson.M{
+		"token_hash": HashToken(token),
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).One(&session)
+
+	if err == mgo.ErrNotFound {
+		return nil, errInvalidSession
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// CheckSession returns the session of token, recording that it was used
+func CheckSession(token string, mongoSession *mgo.Session) (*Session, error) {
+	session, err := FindSession(mongoSession, token)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if now.Sub(session.LastSeen) < touchInterval {
+		return session, nil
+	}
+
+	session.LastSeen = now
+	session.ExpiresAt = session.expiry(now)
+
+	sessionCopy := mongoSession.Copy()
+	defer sessionCopy.Close()
+	err = sessionCopy.DB(Database).C("sessions").UpdateId(session.Id, bson.M{
+		"$set": bson.M{
+			"last_seen":  session.LastSeen,
+			"expires_at": session.ExpiresAt,
+		},
+	})
+	return session, err
+}
+
+// RefreshSession replaces the token of a session, which stays bound to its
+// absolute lifetime
+func RefreshSession(mongoSession *mgo.Session, session *Session) (*LoginResponse, error) {
+	token, err := RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session.TokenHash = HashToken(token)
+	session.LastSeen = now
+	session.ExpiresAt = session.expiry(now)
+
+	err = mongoSession.DB(Database).C("sessions").UpdateId(session.Id, bson.M{
+		"$set": bson.M{
+			"token_hash": session.TokenHash,
+			"last_seen":  session.LastSeen,
+			"expires_at": session.ExpiresAt,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return session.response(token), nil
+}
+
+func DeleteSession(mongoSession *mgo.Session, session *Session) error {
+	return mongoSession.DB(Database).C("sessions").RemoveId(session.Id)
+}
+
+// ListSessions returns the active sessions of the user of current
+func ListSessions(mongoSession *mgo.Session, current *Session) ([]SessionInfo, error) {
+	var sessions []Session
+	err := mongoSession.DB(Database).C("sessions").Find(bson.M{
+		"user":       current.User,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Sort("-last_seen").All(&sessions)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]SessionInfo, len(sessions))
+	for i, session := range sessions {
+		infos[i] = SessionInfo{
+			Session: session,
+			Current: session.Id == current.Id,
+		}
+	}
+	return infos, nil
+}
+
+// RevokeSession ends a session of the user of current
+func RevokeSession(mongoSession *mgo.Session, current *Session, sessionId string) error {
+	if !bson.IsObjectIdHex(sessionId) {
+		return &errorString{"Invalid session id"}
+	}
+	return mongoSession.DB(Database).C("sessions").Remove(bson.M{
+		"_id":  bson.ObjectIdHex(sessionId),
+		"user": current.User,
+	})
+}
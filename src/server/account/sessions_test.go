@@ -0,0 +1,35 @@
+package account
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionExpiry(t *testing.T) {
+	idle, lifetime := SessionIdleTimeout, SessionMaxLifetime
+	SessionIdleTimeout, SessionMaxLifetime = time.Hour, 24*time.Hour
+	defer func() {
+		SessionIdleTimeout, SessionMaxLifetime = idle, lifetime
+	}()
+
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		lastSeen time.Time
+		want     time.Time
+	}{
+		{"just created", created, created.Add(time.Hour)},
+		{"used recently", created.Add(10 * time.Hour), created.Add(11 * time.Hour)},
+		{"close to the lifetime", created.Add(23*time.Hour + 30*time.Minute), created.Add(24 * time.Hour)},
+		{"past the lifetime", created.Add(30 * time.Hour), created.Add(24 * time.Hour)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := Session{CreatedAt: created}
+			if got := s.expiry(test.lastSeen); !got.Equal(test.want) {
+				t.Errorf("expiry(%s) = %s, want %s", test.lastSeen, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package account
+
+import (
+	"fmt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"regexp"
+	"time"
+)
+
+// Speaker names a diarization tag of a translation
+type Speaker struct {
+	Tag    int8   `json:"tag" bson:"tag"`
+	Name   string `json:"name" bson:"name"`
+	Role   string `json:"role,omitempty" bson:"role,omitempty"`
+	Colour string `json:"colour,omitempty" bson:"colour,omitempty"`
+}
+
+var colourPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+func defaultSpeakerName(tag int8) string {
+	return fmt.Sprintf("Speaker %d", tag)
+}
+
+// SpeakerName is the display name of a tag, "Speaker n" when it was not named
+func (t *Translation) SpeakerName(tag int8) string {
+	for _, speaker := range t.Speakers {
+		if speaker.Tag == tag && len(speaker.Name) > 0 {
+			return speaker.Name
+		}
+	}
+	return defaultSpeakerName(tag)
+}
+
+// ApplySpeakers fills the speaker name of every tagged word
+func (t *Translation) ApplySpeakers() {
+	for _, transcripts := range [][]Transcript{t.Transcripts, t.Edited} {
+		for i := range transcripts {
+			for j := range transcripts[i].Alternatives {
+				words := transcripts[i].Alternatives[j].Words
+				for k := range words {
+					if words[k].SpeakerTag != 0 {
+						words[k].Speaker = t.SpeakerName(words[k].SpeakerTag)
+					}
+				}
+			}
+		}
+	}
+}
+
+func SetSpeakers(mongoSession *mgo.Session, t *Translation, speakers []Speaker) error {
+	tags := make(map[int8]bool)
+	for _, speaker := range speakers {
+		if speaker.Tag <= 0 {
+			return fmt.Errorf("invalid speaker tag %d", speaker.Tag)
+		}
+		if tags[speaker.Tag] {
+			return fmt.Errorf("speaker tag %d is named twice", speaker.Tag)
+		}
+		if len(speaker.Colour) > 0 && !colourPattern.MatchString(speaker.Colour) {
+			return fmt.Errorf("invalid colour %s, expected #rrggbb", speaker.Colour)
+		}
+		tags[speaker.Tag] = true
+	}
+
+	collection := mongoSession.DB(Database).C("translations")
+	return collection.UpdateId(t.Id, bson.M{
+		"$set": bson.M{
+			"speakers":   speakers,
+			"updated_at": time.Now(),
+		},
+	})
+}
+
+// MergeSpeakers gives the words of tag from to tag into, as a new revision,
+// for speakers that diarization wrongly split
+func MergeSpeakers(mongoSession *mgo.Session, t *Translation, author bson.ObjectId, from, into int8) (*Revision, error) {
+	if from == into || from <= 0 || into <= 0 {
+		return nil, fmt.Errorf("cannot merge speaker %d into %d", from, into)
+	}
+
+	transcripts := copyTranscripts(t.CurrentTranscripts())
+	for i := range transcripts {
+		for j := range transcripts[i].Alternatives {
+			words := transcripts[i].Alternatives[j].Words
+			for k := range words {
+				if words[k].SpeakerTag == from {
+					words[k].SpeakerTag = into
+				}
+			}
+		}
+	}
+
+	revision, err := saveRevision(mongoSession, t, Revision{
+		Author:      author,
+		Note:        fmt.Sprintf("merged %s into %s", t.SpeakerName(from), t.SpeakerName(into)),
+		Transcripts: transcripts,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = mongoSession.DB(Database).C("translations").UpdateId(t.Id, bson.M{
+		"$pull": bson.M{
+			"speakers": bson.M{"tag": from},
+		},
+	})
+	return revision, err
+}
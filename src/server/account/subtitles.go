@@ -0,0 +1,166 @@
+package account
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Cue is one caption of a subtitle file
+type Cue struct {
+	Start      time.Duration
+	End        time.Duration
+	SpeakerTag int8
+	Speaker    string
+	Text       string
+}
+
+type CueOptions struct {
+	MaxDuration time.Duration
+	MaxChars    int
+	Speakers    bool
+}
+
+var DefaultCueOptions = CueOptions{
+	MaxDuration: 7 * time.Second,
+	MaxChars:    84,
+	Speakers:    false,
+}
+
+// A silence longer than this starts a new cue
+const cueGap = 2 * time.Second
+
+// TranscriptWords lists the timed words of the best alternatives. With
+// diarization Google repeats every word with its speaker tag in the last
+// result, which is then used alone.
+func TranscriptWords(transcripts []Transcript) []Word {
+	words := make([]Word, 0)
+	for _, transcript := range transcripts[wordResults(transcripts):] {
+		if len(transcript.Alternatives) > 0 {
+			words = append(words, transcript.Alternatives[0].Words...)
+		}
+	}
+	return words
+}
+
+// wordResults is the index of the first result TranscriptWords lists, the
+// last one when it repeats the earlier ones
+func wordResults(transcripts []Transcript) int {
+	if len(transcripts) < 2 || len(transcripts[len(transcripts)-1].Alternatives) == 0 {
+		return 0
+	}
+
+	earlier := make([]Word, 0)
+	for _, transcript := range transcripts[:len(transcripts)-1] {
+		if len(transcript.Alternatives) > 0 {
+			earlier = append(earlier, transcript.Alternatives[0].Words...)
+		}
+	}
+	last := transcripts[len(transcripts)-1].Alternatives[0].Words
+	if len(last) > 0 && repeatsWords(last, earlier) {
+		return len(transcripts) - 1
+	}
+	return 0
+}
+
+// repeatsWords tells if last is the diarization result of the earlier
+// words: the same words, or as many words all tagged when none of the
+// earlier ones were
+func repeatsWords(last []Word, earlier []Word) bool {
+	if len(last) != len(earlier) {
+		return false
+	}
+	same, untagged, tagged := true, true, true
+	for i := range last {
+		if last[i].Word != earlier[i].Word ||
+			last[i].StartTime != earlier[i].StartTime ||
+			last[i].EndTime != earlier[i].EndTime {
+			same = false
+		}
+		if earlier[i].SpeakerTag != 0 {
+			untagged = false
+		}
+		if last[i].SpeakerTag == 0 {
+			tagged = false
+		}
+	}
+	return same || (untagged && tagged)
+}
+
+// BuildCues groups words into cues no longer than the options allow, a new
+// cue starting whenever the speaker changes. Speaker names are taken from
+// the words, see Translation.ApplySpeakers.
+func BuildCues(transcripts []Transcript, options CueOptions) []Cue {
+	cues := make([]Cue, 0)
+	var current *Cue
+	for _, word := range TranscriptWords(transcripts) {
+		start := word.StartTime.Duration()
+		end := word.EndTime.Duration()
+		if current != nil {
+			tooLong := options.MaxDuration > 0 && end-current.Start > options.MaxDuration
+			tooWide := options.MaxChars > 0 && len(current.Text)+1+len(word.Word) > options.MaxChars
+			if tooLong || tooWide || start-current.End > cueGap || word.SpeakerTag != current.SpeakerTag {
+				cues = append(cues, *current)
+				current = nil
+			}
+		}
+		if current == nil {
+			current = &Cue{
+				Start:      start,
+				End:        end,
+				SpeakerTag: word.SpeakerTag,
+				Speaker:    word.Speaker,
+				Text:       word.Word,
+			}
+			continue
+		}
+		current.End = end
+		current.Text += " " + word.Word
+	}
+	if current != nil {
+		cues = append(cues, *current)
+	}
+	return cues
+}
+
+func (c *Cue) speakerName() string {
+	if len(c.Speaker) > 0 {
+		return c.Speaker
+	}
+	return defaultSpeakerName(c.SpeakerTag)
+}
+
+func formatCueTime(d time.Duration, separator string) string {
+	millis := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d",
+		millis/3600000, millis/60000%60, millis/1000%60, separator, millis%1000)
+}
+
+func RenderSRT(cues []Cue, options CueOptions) string {
+	var b strings.Builder
+	for i, cue := range cues {
+		text := cue.Text
+		if options.Speakers && cue.SpeakerTag != 0 {
+			text = fmt.Sprintf("%s: %s", cue.speakerName(), text)
+		}
+		_, _ = fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n",
+			i+1, formatCueTime(cue.Start, ","), formatCueTime(cue.End, ","), text)
+	}
+	return b.String()
+}
+
+var vttEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func RenderVTT(cues []Cue, options CueOptions) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\n")
+	for _, cue := range cues {
+		text := vttEscaper.Replace(cue.Text)
+		if options.Speakers && cue.SpeakerTag != 0 {
+			text = fmt.Sprintf("<v %s>%s", vttEscaper.Replace(cue.speakerName()), text)
+		}
+		_, _ = fmt.Fprintf(&b, "%s --> %s\n%s\n\n",
+			formatCueTime(cue.Start, "."), formatCueTime(cue.End, "."), text)
+	}
+	return b.String()
+}
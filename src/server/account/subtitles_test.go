@@ -0,0 +1,214 @@
+package account
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func word(text string, start int64, tag int8) Word {
+	return Word{
+		StartTime:  ResultEndTime{Seconds: start},
+		EndTime:    ResultEndTime{Seconds: start + 1},
+		Word:       text,
+		SpeakerTag: tag,
+	}
+}
+
+func result(words ...Word) Transcript {
+	return Transcript{Alternatives: []Alternative{{Words: words}}}
+}
+
+func TestTranscriptWords(t *testing.T) {
+	hello, world := word("hello", 0, 0), word("world", 1, 0)
+	tests := []struct {
+		name        string
+		transcripts []Transcript
+		want        []Word
+	}{
+		{
+			name:        "single result",
+			transcripts: []Transcript{result(hello, world)},
+			want:        []Word{hello, world},
+		},
+		{
+			name: "diarization summary repeating the words",
+			transcripts: []Transcript{
+				result(hello),
+				result(world),
+				result(word("hello", 0, 1), word("world", 1, 2)),
+			},
+			want: []Word{word("hello", 0, 1), word("world", 1, 2)},
+		},
+		{
+			name: "tagged summary of untagged words",
+			transcripts: []Transcript{
+				result(hello),
+				result(world),
+				result(word("hallo", 0, 1), word("world", 1, 1)),
+			},
+			want: []Word{word("hallo", 0, 1), word("world", 1, 1)},
+		},
+		{
+			name: "long tagged last result of a local engine",
+			transcripts: []Transcript{
+				result(word("one", 0, 1)),
+				result(word("two", 1, 2), word("three", 2, 2), word("four", 3, 1)),
+			},
+			want: []Word{word("one", 0, 1), word("two", 1, 2), word("three", 2, 2), word("four", 3, 1)},
+		},
+		{
+			name: "untagged results of the same length",
+			transcripts: []Transcript{
+				result(hello, world),
+				result(word("good", 2, 0), word("bye", 3, 0)),
+			},
+			want: []Word{hello, world, word("good", 2, 0), word("bye", 3, 0)},
+		},
+		{
+			name: "tagged results following tagged ones",
+			transcripts: []Transcript{
+				result(word("hello", 0, 1)),
+				result(word("again", 1, 2)),
+			},
+			want: []Word{word("hello", 0, 1), word("again", 1, 2)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := TranscriptWords(test.transcripts)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("TranscriptWords() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildCues(t *testing.T) {
+	type cue struct {
+		start, end int64
+		text       string
+	}
+	tests := []struct {
+		name    string
+		words   []Word
+		options CueOptions
+		want    []cue
+	}{
+		{
+			name:    "one cue",
+			words:   []Word{word("hello", 0, 0), word("world", 1, 0)},
+			options: DefaultCueOptions,
+			want:    []cue{{0, 2, "hello world"}},
+		},
+		{
+			name:    "speaker change",
+			words:   []Word{word("hello", 0, 1), word("world", 1, 1), word("bye", 2, 2)},
+			options: DefaultCueOptions,
+			want:    []cue{{0, 2, "hello world"}, {2, 3, "bye"}},
+		},
+		{
+			name:    "silence",
+			words:   []Word{word("hello", 0, 0), word("world", 4, 0)},
+			options: DefaultCueOptions,
+			want:    []cue{{0, 1, "hello"}, {4, 5, "world"}},
+		},
+		{
+			name:    "too many characters",
+			words:   []Word{word("hello", 0, 0), word("world", 1, 0), word("again", 2, 0)},
+			options: CueOptions{MaxDuration: time.Minute, MaxChars: 11},
+			want:    []cue{{0, 2, "hello world"}, {2, 3, "again"}},
+		},
+		{
+			name: "too long",
+			words: []Word{
+				word("one", 0, 0), word("two", 1, 0), word("three", 2, 0),
+				word("four", 3, 0), word("five", 4, 0),
+			},
+			options: CueOptions{MaxDuration: 3 * time.Second},
+			want:    []cue{{0, 3, "one two three"}, {3, 5, "four five"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cues := BuildCues([]Transcript{result(test.words...)}, test.options)
+			got := make([]cue, len(cues))
+			for i, c := range cues {
+				got[i] = cue{int64(c.Start / time.Second), int64(c.End / time.Second), c.Text}
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("BuildCues() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+var renderedCues = []Cue{
+	{Start: 0, End: 1500 * time.Millisecond, Text: "Hello"},
+	{Start: 61*time.Second + 20*time.Millisecond, End: 3661 * time.Second, SpeakerTag: 2, Speaker: "Ann", Text: "a < b"},
+	{Start: 3662 * time.Second, End: 3663 * time.Second, SpeakerTag: 3, Text: "bye"},
+}
+
+func TestRenderSRT(t *testing.T) {
+	tests := []struct {
+		name     string
+		speakers bool
+		want     string
+	}{
+		{
+			name: "text only",
+			want: "1\n00:00:00,000 --> 00:00:01,500\nHello\n\n" +
+				"2\n00:01:01,020 --> 01:01:01,000\na < b\n\n" +
+				"3\n01:01:02,000 --> 01:01:03,000\nbye\n\n",
+		},
+		{
+			name:     "speakers",
+			speakers: true,
+			want: "1\n00:00:00,000 --> 00:00:01,500\nHello\n\n" +
+				"2\n00:01:01,020 --> 01:01:01,000\nAnn: a < b\n\n" +
+				"3\n01:01:02,000 --> 01:01:03,000\nSpeaker 3: bye\n\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := RenderSRT(renderedCues, CueOptions{Speakers: test.speakers})
+			if got != test.want {
+				t.Errorf("RenderSRT() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRenderVTT(t *testing.T) {
+	tests := []struct {
+		name     string
+		speakers bool
+		want     string
+	}{
+		{
+			name: "text only",
+			want: "WEBVTT\n\n00:00:00.000 --> 00:00:01.500\nHello\n\n" +
+				"00:01:01.020 --> 01:01:01.000\na &lt; b\n\n" +
+				"01:01:02.000 --> 01:01:03.000\nbye\n\n",
+		},
+		{
+			name:     "speakers",
+			speakers: true,
+			want: "WEBVTT\n\n00:00:00.000 --> 00:00:01.500\nHello\n\n" +
+				"00:01:01.020 --> 01:01:01.000\n<v Ann>a &lt; b\n\n" +
+				"01:01:02.000 --> 01:01:03.000\n<v Speaker 3>bye\n\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := RenderVTT(renderedCues, CueOptions{Speakers: test.speakers})
+			if got != test.want {
+				t.Errorf("RenderVTT() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
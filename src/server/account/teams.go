@@ -0,0 +1,402 @@
+package account
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"time"
+)
+
+// Roles in a team. Viewers and editors have that access to the translations
+// of the team, managers also manage its members.
+const (
+	TeamRoleViewer  = "viewer"
+	TeamRoleEditor  = "editor"
+	TeamRoleManager = "manager"
+)
+
+var (
+	ErrNotTeamManager = errors.New("Only managers of the team can do this")
+	ErrNotTeamMember  = errors.New("You are not a member of this team")
+	errInvalidTeam    = errors.New("Invalid team id")
+	errTeamRole       = errors.New("Invalid team role, expected viewer, editor or manager")
+	errLastManager    = errors.New("A team needs at least one manager")
+	errAlreadyMember  = errors.New("This account is already a member of the team")
+)
+
+// TeamMember is an account of a team with its role
+type TeamMember struct {
+	User bson.ObjectId `json:"user" bson:"user"`
+	Role string        `json:"role" bson:"role"`
+	// Name of the account, filled when listing members
+	Name string `json:"name,omitempty" bson:"-"`
+}
+
+// Team is a workspace whose translations all its members can access
+type Team struct {
+	Id        bson.ObjectId `json:"_id" bson:"_id,omitempty"`
+	Name      string        `json:"name" bson:"name"`
+	Members   []TeamMember  `json:"members" bson:"members"`
+	CreatedBy bson.ObjectId `json:"created_by" bson:"created_by"`
+	CreatedAt time.Time     `json:"created_at" bson:"created_at"`
+}
+
+func ValidTeamRole(role string) bool {
+	return role == TeamRoleViewer || role == TeamRoleEditor || role == TeamRoleManager
+}
+
+// TeamAccess is the access to the translations of a team given by role
+func TeamAccess(role string) string {
+	switch role {
+	case TeamRoleViewer:
+		return AccessViewer
+	case TeamRoleEditor, TeamRoleManager:
+		return AccessEditor
+	}
+	return AccessNone
+}
+
+// RoleOf returns the role of user in the team, empty when not a member
+func (t *Team) RoleOf(user bson.ObjectId) string {
+	for _, member := range t.Members {
+		if member.User == user {
+			return member.Role
+		}
+	}
+	return ""
+}
+
+func (t *Team) managers() int {
+	count := 0
+	for _, member := range t.Members {
+		if member.Role == TeamRoleManager {
+			count++
+		}
+	}
+	return count
+}
+
+func ensureTeamIndexes(mongoSession *mgo.Session) error {
+	err := mongoSession.DB(Database).C("teams").EnsureIndex(mgo.Index{
+		Key: []string{"members.user"},
+	})
+	if err != nil {
+		return err
+	}
+	return mongoSession.DB(Database).C("translations").EnsureIndex(mgo.Index{
+		Key:    []string{"team"},
+		Sparse: true,
+	})
+}
+
+func parseTeamId(teamId string) (bson.ObjectId, error) {
+	if !bson.IsObjectIdHex(teamId) {
+		return "", errInvalidTeam
+	}
+	return bson.ObjectIdHex(teamId), nil
+}
+
+func FindTeam(mongoSession *mgo.Session, teamId string) (*Team, error) {
+	id, err := parseTeamId(teamId)
+	if err != nil {
+		return nil, err
+	}
+	var t Team
+	err = mongoSession.DB(Database).C("teams").FindId(id).One(&t)
+	if err == mgo.ErrNotFound {
+		return nil, errInvalidTeam
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// MemberTeam returns the team teamId if user is one of its members
+func MemberTeam(mongoSession *mgo.Session, teamId string, user bson.ObjectId) (*Team, error) {
+	t, err := FindTeam(mongoSession, teamId)
+	if err != nil {
+		return nil, err
+	}
+	if len(t.RoleOf(user)) == 0 {
+		return nil, ErrNotTeamMember
+	}
+	return t, nil
+}
+
+// ManagedTeam returns the team teamId if user manages it
+func ManagedTeam(mongoSession *mgo.Session, teamId string, user bson.ObjectId) (*Team, error) {
+	t, err := MemberTeam(mongoSession, teamId, user)
+	if err != nil {
+		return nil, err
+	}
+	if t.RoleOf(user) != TeamRoleManager {
+		return nil, ErrNotTeamManager
+	}
+	return t, nil
+}
+
+// TeamIds returns the teams user is a member of
+func TeamIds(mongoSession *mgo.Session, user bson.ObjectId) ([]bson.ObjectId, error) {
+	var teams []Team
+	err := mongoSession.DB(Database).C("teams").Find(bson.M{
+		"members.user": user,
+	}).Select(bson.M{"_id": 1}).All(&teams)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]bson.ObjectId, len(teams))
+	for i, t := range teams {
+		ids[i] = t.Id
+	}
+	return ids, nil
+}
+
+// CreateTeam makes a team managed by its creator
+func CreateTeam(mongoSession *mgo.Session, creator bson.ObjectId, name string) (*Team, error) {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		return nil, &errorString{"Missing team name"}
+	}
+
+	t := Team{
+		Id:        bson.NewObjectId(),
+		Name:      name,
+		Members:   []TeamMember{{User: creator, Role: TeamRoleManager}},
+		CreatedBy: creator,
+		CreatedAt: time.Now(),
+	}
+	if err := mongoSession.DB(Database).C("teams").Insert(&t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ListTeams returns the teams of user
+func ListTeams(mongoSession *mgo.Session, user bson.ObjectId) (teams []Team, err error) {
+	teams = make([]Team, 0)
+	err = mongoSession.DB(Database).C("teams").Find(bson.M{
+		"members.user": user,
+	}).Sort("name").All(&teams)
+	return teams, err
+}
+
+// FillMemberNames sets the account names of the members of t
+func FillMemberNames(mongoSession *mgo.Session, t *Team) error {
+	users := make([]bson.ObjectId, len(t.Members))
+	for i, member := range t.Members {
+		users[i] = member.User
+	}
+
+	var accounts []Account
+	err := mongoSession.DB(Database).C("accounts").Find(bson.M{
+		"_id": bson.M{"$in": users},
+	}).Select(bson.M{"name": 1}).All(&accounts)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[bson.ObjectId]string)
+	for _, a := range accounts {
+		names[a.Id] = a.Name
+	}
+	for i := range t.Members {
+		t.Members[i].Name = names[t.Members[i].User]
+	}
+	return nil
+}
+
+// AddTeamMember adds the account userId to t with role
+func AddTeamMember(mongoSession *mgo.Session, t *Team, userId string, role string) error {
+	if !ValidTeamRole(role) {
+		return errTeamRole
+	}
+	user, err := parseAccountId(userId)
+	if err != nil {
+		return err
+	}
+	if _, err = FindAccount(mongoSession, user); err != nil {
+		return err
+	}
+
+	err = mongoSession.DB(Database).C("teams").Update(bson.M{
+		"_id":          t.Id,
+		"members.user": bson.M{"$ne": user},
+	}, bson.M{
+		"$push": bson.M{"members": TeamMember{User: user, Role: role}},
+	})
+	if err == mgo.ErrNotFound {
+		return errAlreadyMember
+	}
+	return err
+}
+
+// otherManager matches the teams with a manager besides user, so that the
+// last one cannot be demoted or removed by concurrent requests
+func otherManager(user bson.ObjectId) bson.M {
+	return bson.M{"$elemMatch": bson.M{"role": TeamRoleManager, "user": bson.M{"$ne": user}}}
+}
+
+// UpdateTeamMember changes the role of a member of t
+func UpdateTeamMember(mongoSession *mgo.Session, t *Team, userId string, role string) error {
+	if !ValidTeamRole(role) {
+		return errTeamRole
+	}
+	user, err := parseAccountId(userId)
+	if err != nil {
+		return err
+	}
+
+	collection := mongoSession.DB(Database).C("teams")
+	team := *t
+	for {
+		index := -1
+		for i, m := range team.Members {
+			if m.User == user {
+				index = i
+			}
+		}
+		if index < 0 {
+			return &errorString{"This account is not a member of the team"}
+		}
+		if team.Members[index].Role == TeamRoleManager && role != TeamRoleManager && team.managers() == 1 {
+			return errLastManager
+		}
+
+		// The member is found by its position, the filter failing when
+		// members moved since the team was read
+		prefix := fmt.Sprintf("members.%d.", index)
+		filter := bson.M{"_id": t.Id, prefix + "user": user}
+		if role != TeamRoleManager {
+			filter["members"] = otherManager(user)
+		}
+		err = collection.Update(filter, bson.M{
+			"$set": bson.M{prefix + "role": role},
+		})
+		if err != mgo.ErrNotFound {
+			return err
+		}
+
+		if err = collection.FindId(t.Id).One(&team); err != nil {
+			return err
+		}
+	}
+}
+
+// RemoveTeamMember removes a member of t, who loses access to its
+// translations
+func RemoveTeamMember(mongoSession *mgo.Session, t *Team, userId string) error {
+	user, err := parseAccountId(userId)
+	if err != nil {
+		return err
+	}
+
+	collection := mongoSession.DB(Database).C("teams")
+	team := *t
+	for {
+		role := team.RoleOf(user)
+		if len(role) == 0 {
+			return &errorString{"This account is not a member of the team"}
+		}
+		if role == TeamRoleManager && team.managers() == 1 {
+			return errLastManager
+		}
+
+		err = collection.Update(bson.M{
+			"_id":          t.Id,
+			"members.user": user,
+			"members":      otherManager(user),
+		}, bson.M{
+			"$pull": bson.M{"members": bson.M{"user": user}},
+		})
+		if err != mgo.ErrNotFound {
+			return err
+		}
+
+		if err = collection.FindId(t.Id).One(&team); err != nil {
+			return err
+		}
+	}
+}
+
+// DeleteTeam removes t and its projects, its translations going back to
+// their owners only
+func DeleteTeam(mongoSession *mgo.Session, t *Team) error {
+	_, err := mongoSession.DB(Database).C("translations").UpdateAll(bson.M{
+		"team": t.Id,
+	}, bson.M{
+		"$unset": bson.M{"team": ""},
+	})
+	if err != nil {
+		return err
+	}
+
+	var projects []Project
+	err = mongoSession.DB(Database).C("projects").Find(bson.M{"team": t.Id}).Select(bson.M{"_id": 1}).All(&projects)
+	if err != nil {
+		return err
+	}
+	ids := make([]bson.ObjectId, len(projects))
+	for i, p := range projects {
+		ids[i] = p.Id
+	}
+	_, err = mongoSession.DB(Database).C("translations").UpdateAll(bson.M{
+		"project": bson.M{"$in": ids},
+	}, bson.M{
+		"$unset": bson.M{"project": ""},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err = mongoSession.DB(Database).C("projects").RemoveAll(bson.M{"team": t.Id}); err != nil {
+		return err
+	}
+
+	return mongoSession.DB(Database).C("teams").RemoveId(t.Id)
+}
+
+// MoveToTeam puts the translation tr in the team teamId, where user must be
+// at least an editor, or takes it out of its team when teamId is empty. It
+// leaves its project, which belongs to the former team.
+func MoveToTeam(mongoSession *mgo.Session, tr *Translation, user bson.ObjectId, teamId string) error {
+	collection := mongoSession.DB(Database).C("translations")
+	if len(teamId) == 0 {
+		if len(tr.Team) == 0 {
+			return nil
+		}
+		return collection.UpdateId(tr.Id, bson.M{
+			"$unset": bson.M{"team": "", "project": ""},
+		})
+	}
+
+	t, err := MemberTeam(mongoSession, teamId, user)
+	if err != nil {
+		return err
+	}
+	if !AccessAllows(TeamAccess(t.RoleOf(user)), AccessEditor) {
+		return &errorString{"Only editors and managers can add translations to a team"}
+	}
+
+	if t.Id == tr.Team {
+		return nil
+	}
+	return collection.UpdateId(tr.Id, bson.M{
+		"$set":   bson.M{"team": t.Id},
+		"$unset": bson.M{"project": ""},
+	})
+}
+
+// teamAccess returns the access user has to the translations of team
+func teamAccess(mongoSession *mgo.Session, team bson.ObjectId, user bson.ObjectId) (string, error) {
+	var t Team
+	err := mongoSession.DB(Database).C("teams").FindId(team).One(&t)
+	if err == mgo.ErrNotFound {
+		return AccessNone, nil
+	}
+	if err != nil {
+		return AccessNone, err
+	}
+	return TeamAccess(t.RoleOf(user)), nil
+}
@@ -0,0 +1,339 @@
+package account
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TotpIssuer names the server in authenticator apps
+var TotpIssuer = "Speech to text"
+
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// Codes of the steps before and after the current one are accepted
+	// too, for clocks that drift
+	totpSkew = 1
+	// Number of recovery codes given at enrollment
+	recoveryCodeCount = 10
+	// Time given to enter a code after the password
+	mfaChallengeLifetime = 5 * time.Minute
+	// Wrong codes accepted for one challenge
+	mfaChallengeAttempts = 5
+)
+
+var (
+	ErrInvalidCode         = errors.New("Invalid authentication code")
+	ErrInvalidMfaChallenge = errors.New("Invalid or expired login, please log in again")
+	errTotpEnabled         = errors.New("Two-factor authentication is already enabled")
+	errTotpNotEnabled      = errors.New("Two-factor authentication is not enabled")
+	errTotpNotEnrolled     = errors.New("Start the enrollment first")
+)
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TotpEnrollment is what authenticator apps need to generate codes
+type TotpEnrollment struct {
+	Secret string `json:"secret"`
+	Uri    string `json:"uri"`
+}
+
+// mfaChallenge is a login whose password was checked, waiting for the
+// second factor
+type mfaChallenge struct {
+	Id        bson.ObjectId `bson:"_id"`
+	TokenHash string        `bson:"token_hash"`
+	User      bson.ObjectId `bson:"user"`
+	Attempts  int           `bson:"attempts"`
+	ExpiresAt time.Time     `bson:"expires_at"`
+}
+
+func ensureMfaIndexes(mongoSession *mgo.Session) error {
+	return mongoSession.DB(Database).C("mfa_challenges").EnsureIndex(mgo.Index{
+		Key:         []string{"expires_at"},
+		ExpireAfter: time.Second,
+	})
+}
+
+// totpCode is the HOTP value of counter, as described by RFC 4226
+func totpCode(key []byte, counter uint64) string {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(buf)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// matchTotp returns the time step code is valid for around now, or -1
+func matchTotp(secret string, code string, now time.Time) int64 {
+	key, err := base32NoPadding.DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return -1
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, uint64(step))), []byte(code)) == 1 {
+			return step
+		}
+	}
+	return -1
+}
+
+// normalizeCode removes what users type in codes besides their characters
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 6)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(base32NoPadding.EncodeToString(b))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = HashToken(code)
+	}
+	return codes, hashes, nil
+}
+
+// EnrollTotp generates a secret for user, only used once confirmed by
+// ConfirmTotp
+func EnrollTotp(mongoSession *mgo.Session, user bson.ObjectId) (*TotpEnrollment, error) {
+	a, err := FindAccount(mongoSession, user)
+	if err != nil {
+		return nil, err
+	}
+	if a.TotpEnabled {
+		return nil, errTotpEnabled
+	}
+
+	b := make([]byte, 20)
+	if _, err = rand.Read(b); err != nil {
+		return nil, err
+	}
+	secret := base32NoPadding.EncodeToString(b)
+
+	err = mongoSession.DB(Database).C("accounts").UpdateId(user, bson.M{
+		"$set": bson.M{"totp_pending": secret},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	label := url.PathEscape(TotpIssuer + ":" + a.Name)
+	query := url.Values{
+		"secret":    {secret},
+		"issuer":    {TotpIssuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(totpPeriod)},
+	}
+	return &TotpEnrollment{
+		Secret: secret,
+		Uri:    "otpauth://totp/" + label + "?" + query.Encode(),
+	}, nil
+}
+
+// ConfirmTotp enables the pending secret of user when code matches it, and
+// returns the recovery codes, which cannot be found again
+func ConfirmTotp(mongoSession *mgo.Session, user bson.ObjectId, code string) ([]string, error) {
+	a, err := FindAccount(mongoSession, user)
+	if err != nil {
+		return nil, err
+	}
+	if a.TotpEnabled {
+		return nil, errTotpEnabled
+	}
+	if len(a.TotpPending) == 0 {
+		return nil, errTotpNotEnrolled
+	}
+
+	step := matchTotp(a.TotpPending, normalizeCode(code), time.Now())
+	if step < 0 {
+		return nil, ErrInvalidCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = mongoSession.DB(Database).C("accounts").UpdateId(user, bson.M{
+		"$set": bson.M{
+			"totp_enabled":   true,
+			"totp_secret":    a.TotpPending,
+			"totp_last_step": step,
+			"recovery_codes": hashes,
+		},
+		"$unset": bson.M{"totp_pending": ""},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// CheckSecondFactor accepts a current TOTP code, never used before, or a
+// recovery code, which is used up
+func CheckSecondFactor(mongoSession *mgo.Session, a *Account, code string) error {
+	if !a.TotpEnabled {
+		return errTotpNotEnabled
+	}
+	collection := mongoSession.DB(Database).C("accounts")
+	code = normalizeCode(code)
+
+	if step := matchTotp(a.TotpSecret, code, time.Now()); step >= 0 {
+		// Only a later step than the last one used is accepted, so that
+		// a code seen by someone else cannot be replayed
+		err := collection.Update(bson.M{
+			"_id":            a.Id,
+			"totp_last_step": bson.M{"$not": bson.M{"$gte": step}},
+		}, bson.M{
+			"$set": bson.M{"totp_last_step": step},
+		})
+		if err == mgo.ErrNotFound {
+			return ErrInvalidCode
+		}
+		return err
+	}
+
+	hash := HashToken(code)
+	err := collection.Update(bson.M{
+		"_id":            a.Id,
+		"recovery_codes": hash,
+	}, bson.M{
+		"$pull": bson.M{"recovery_codes": hash},
+	})
+	if err == mgo.ErrNotFound {
+		return ErrInvalidCode
+	}
+	return err
+}
+
+// DisableTotp turns two-factor authentication off after checking code
+func DisableTotp(mongoSession *mgo.Session, user bson.ObjectId, code string) error {
+	a, err := FindAccount(mongoSession, user)
+	if err != nil {
+		return err
+	}
+	if err = CheckSecondFactor(mongoSession, a, code); err != nil {
+		return err
+	}
+	return removeTotp(mongoSession, user)
+}
+
+// ResetTotp turns two-factor authentication off for a user who lost their
+// authenticator and recovery codes
+func ResetTotp(mongoSession *mgo.Session, userId string) error {
+	user, err := parseAccountId(userId)
+	if err != nil {
+		return err
+	}
+	return removeTotp(mongoSession, user)
+}
+
+func removeTotp(mongoSession *mgo.Session, user bson.ObjectId) error {
+	return mongoSession.DB(Database).C("accounts").UpdateId(user, bson.M{
+		"$set": bson.M{"totp_enabled": false},
+		"$unset": bson.M{
+			"totp_secret":    "",
+			"totp_pending":   "",
+			"totp_last_step": "",
+			"recovery_codes": "",
+		},
+	})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of user after
+// checking code
+func RegenerateRecoveryCodes(mongoSession *mgo.Session, user bson.ObjectId, code string) ([]string, error) {
+	a, err := FindAccount(mongoSession, user)
+	if err != nil {
+		return nil, err
+	}
+	if err = CheckSecondFactor(mongoSession, a, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = mongoSession.DB(Database).C("accounts").UpdateId(user, bson.M{
+		"$set": bson.M{"recovery_codes": hashes},
+	})
+	return codes, err
+}
+
+// CreateMfaChallenge returns the token completing the login of user with
+// its second factor
+func CreateMfaChallenge(mongoSession *mgo.Session, user bson.ObjectId) (string, error) {
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	err = mongoSession.DB(Database).C("mfa_challenges").Insert(&mfaChallenge{
+		Id:        bson.NewObjectId(),
+		TokenHash: HashToken(token),
+		User:      user,
+		ExpiresAt: time.Now().Add(mfaChallengeLifetime),
+	})
+	return token, err
+}
+
+// FindMfaChallenge returns the account of an unexpired challenge and counts
+// the attempt, a challenge being dropped after too many of them
+func FindMfaChallenge(mongoSession *mgo.Session, token string) (*Account, error) {
+	collection := mongoSession.DB(Database).C("mfa_challenges")
+
+	var challenge mfaChallenge
+	_, err := collection.Find(bson.M{
+		"token_hash": HashToken(token),
+		"expires_at": bson.M{"$gt": time.Now()},
+		"attempts":   bson.M{"$lt": mfaChallengeAttempts},
+	}).Apply(mgo.Change{
+		Update:    bson.M{"$inc": bson.M{"attempts": 1}},
+		ReturnNew: true,
+	}, &challenge)
+	if err == mgo.ErrNotFound {
+		return nil, ErrInvalidMfaChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := FindAccount(mongoSession, challenge.User)
+	if err != nil {
+		return nil, err
+	}
+	if a.Disabled {
+		return nil, ErrAccountDisabled
+	}
+	return a, nil
+}
+
+// CompleteMfaChallenge ends a challenge once its second factor is checked
+func CompleteMfaChallenge(mongoSession *mgo.Session, token string) error {
+	_, err := mongoSession.DB(Database).C("mfa_challenges").RemoveAll(bson.M{
+		"token_hash": HashToken(token),
+	})
+	return err
+}
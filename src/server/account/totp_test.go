@@ -0,0 +1,61 @@
+package account
+
+import (
+	"testing"
+	"time"
+)
+
+// Secret of the test vectors of RFC 4226 and RFC 6238
+var rfcSecret = []byte("12345678901234567890")
+
+func TestTotpCode(t *testing.T) {
+	// The last six digits of the HOTP values of RFC 4226, appendix D
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, code := range want {
+		if got := totpCode(rfcSecret, uint64(counter)); got != code {
+			t.Errorf("totpCode(%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestMatchTotp(t *testing.T) {
+	secret := base32NoPadding.EncodeToString(rfcSecret)
+	// Time step 1
+	now := time.Unix(59, 0)
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		want   int64
+	}{
+		{"current step", secret, "287082", 1},
+		{"previous step", secret, "755224", 0},
+		{"next step", secret, "359152", 2},
+		{"beyond the skew", secret, "969429", -1},
+		{"wrong code", secret, "123456", -1},
+		{"short code", secret, "28708", -1},
+		{"invalid secret", "not base32!", "287082", -1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := matchTotp(test.secret, test.code, now); got != test.want {
+				t.Errorf("matchTotp(%s) = %d, want %d", test.code, got, test.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeCode(t *testing.T) {
+	tests := map[string]string{
+		"287 082":     "287082",
+		"abcde-fghij": "abcdefghij",
+		"ABCDE FGHIJ": "abcdefghij",
+	}
+	for code, want := range tests {
+		if got := normalizeCode(code); got != want {
+			t.Errorf("normalizeCode(%q) = %q, want %q", code, got, want)
+		}
+	}
+}
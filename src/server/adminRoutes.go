@@ -0,0 +1,282 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"speech-to-text-back/src/server/account"
+	"strconv"
+	"time"
+)
+
+// requireRole only lets accounts with at least role reach cb
+func requireRole(role string, cb route) route {
+	return func(h *Handler, w http.ResponseWriter, r *http.Request) {
+		sess, err := requestSession(h, r)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		sessionCopy := h.MongoSession.Copy()
+		defer sessionCopy.Close()
+
+		a, err := account.FindAccount(sessionCopy, sess.User)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		if !a.HasRole(role) {
+			http.Error(w, account.ErrNotAllowed.Error(), http.StatusForbidden)
+			return
+		}
+
+		cb(h, w, r)
+	}
+}
+
+type AdminAccountRequest struct {
+	Account  string `json:"account"`
+	Role     string `json:"role"`
+	Password string `json:"password"`
+	// Ip is also unlocked by /admin/accounts/unlock when it is set
+	Ip string `json:"ip"`
+}
+
+// adminAccountRoute decodes an AdminAccountRequest and runs action with the
+// admin's id
+func adminAccountRoute(action func(h *Handler, admin *account.Session, req *AdminAccountRequest) error) route {
+	return func(h *Handler, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+
+		var req AdminAccountRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		sess, err := requestSession(h, r)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		err = action(h, sess, &req)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		_, _ = fmt.Fprintf(w, "ok")
+	}
+}
+
+var AdminDisableAccount = adminAccountRoute(func(h *Handler, admin *account.Session, req *AdminAccountRequest) error {
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+	return account.SetAccountDisabled(sessionCopy, admin.User, req.Account, true)
+})
+
+var AdminEnableAccount = adminAccountRoute(func(h *Handler, admin *account.Session, req *AdminAccountRequest) error {
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+	return account.SetAccountDisabled(sessionCopy, admin.User, req.Account, false)
+})
+
+var AdminResetPassword = adminAccountRoute(func(h *Handler, _ *account.Session, req *AdminAccountRequest) error {
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+	return account.ResetPassword(sessionCopy, req.Account, req.Password)
+})
+
+var AdminChangeRole = adminAccountRoute(func(h *Handler, admin *account.Session, req *AdminAccountRequest) error {
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+	return account.SetAccountRole(sessionCopy, admin.User, req.Account, req.Role)
+})
+
+var AdminUnlockAccount = adminAccountRoute(func(h *Handler, admin *account.Session, req *AdminAccountRequest) error {
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+	return account.UnlockLogin(sessionCopy, admin.User, req.Account, req.Ip)
+})
+
+var AdminResetTotp = adminAccountRoute(func(h *Handler, _ *account.Session, req *AdminAccountRequest) error {
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+	return account.ResetTotp(sessionCopy, req.Account)
+})
+
+func AdminAudit(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	limit := 100
+	if limitStr := r.URL.Query().Get("limit"); len(limitStr) > 0 {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid query param for limit: %s", limitStr), http.StatusBadRequest)
+			return
+		}
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	events, err := account.ListAudit(sessionCopy, r.URL.Query().Get("type"), limit)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	serialized, err := json.Marshal(events)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "%s", string(serialized))
+}
+
+type InvitationCreateRequest struct {
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	TeamId    string    `json:"teamId"`
+	TeamRole  string    `json:"teamRole"`
+	MaxUses   int       `json:"maxUses"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type InvitationCreateResponse struct {
+	Code       string              `json:"code"`
+	Invitation *account.Invitation `json:"invitation"`
+}
+
+type InvitationRevokeRequest struct {
+	InvitationId string `json:"invitationId"`
+}
+
+func AdminInvitationCreate(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	var req InvitationCreateRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sess, err := requestSession(h, r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	invitation := account.Invitation{
+		Email:     req.Email,
+		Role:      req.Role,
+		TeamRole:  req.TeamRole,
+		MaxUses:   req.MaxUses,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if len(req.TeamId) > 0 {
+		if !bson.IsObjectIdHex(req.TeamId) {
+			http.Error(w, "Invalid team id", http.StatusBadRequest)
+			return
+		}
+		invitation.Team = bson.ObjectIdHex(req.TeamId)
+	}
+
+	inv, code, err := account.CreateInvitation(sessionCopy, h.Notifier, sess.User, invitation)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	serialized, err := json.Marshal(InvitationCreateResponse{Code: code, Invitation: inv})
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "%s", string(serialized))
+}
+
+func AdminInvitations(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	invitations, err := account.ListInvitations(sessionCopy)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	serialized, err := json.Marshal(invitations)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "%s", string(serialized))
+}
+
+func AdminInvitationRevoke(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	var req InvitationRevokeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	err = account.RevokeInvitation(sessionCopy, req.InvitationId)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "ok")
+}
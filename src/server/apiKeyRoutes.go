@@ -0,0 +1,132 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"speech-to-text-back/src/server/account"
+	"time"
+)
+
+type ApiKeyCreateRequest struct {
+	Label     string     `json:"label"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type ApiKeyCreateResponse struct {
+	Token string          `json:"token"`
+	Key   *account.ApiKey `json:"key"`
+}
+
+type ApiKeyRevokeRequest struct {
+	KeyId string `json:"keyId"`
+}
+
+func ApiKeyCreate(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	var req ApiKeyCreateRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sess, err := requestSession(h, r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	key, token, err := account.CreateApiKey(sessionCopy, sess.User, req.Label, req.Scopes, req.ExpiresAt)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	serialized, err := json.Marshal(ApiKeyCreateResponse{Token: token, Key: key})
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "%s", string(serialized))
+}
+
+func ApiKeyList(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	sess, err := requestSession(h, r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	keys, err := account.ListApiKeys(sessionCopy, sess.User)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	serialized, err := json.Marshal(keys)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "%s", string(serialized))
+}
+
+func ApiKeyRevoke(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	var req ApiKeyRevokeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sess, err := requestSession(h, r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	err = account.RevokeApiKey(sessionCopy, sess.User, req.KeyId)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "ok")
+}
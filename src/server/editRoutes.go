@@ -0,0 +1,235 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"speech-to-text-back/src/server/account"
+)
+
+type TranslationEditRequest struct {
+	TranslationId string         `json:"translationId"`
+	Edits         []account.Edit `json:"edits"`
+}
+
+type TranslationSpeakersRequest struct {
+	TranslationId string            `json:"translationId"`
+	Speakers      []account.Speaker `json:"speakers"`
+}
+
+type TranslationSpeakersMergeRequest struct {
+	TranslationId string `json:"translationId"`
+	From          int8   `json:"from"`
+	Into          int8   `json:"into"`
+}
+
+type TranslationRevertRequest struct {
+	TranslationId string `json:"translationId"`
+	Revision      int    `json:"revision"`
+}
+
+type TranslationMetadataRequest struct {
+	TranslationId string `json:"translationId"`
+	account.Metadata
+}
+
+func writeRevision(w http.ResponseWriter, revision *account.Revision, err error) {
+	if err == account.ErrConflict || err == account.ErrNotRecognized {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	revision.Transcripts = nil
+	serialized, err := json.Marshal(revision)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "%s", string(serialized))
+}
+
+func TranslationEdit(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	var req TranslationEditRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, sess, ok := authorizeTranslation(h, w, r, req.TranslationId, account.AccessEditor)
+
+	if !ok {
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	revision, err := account.EditTranslation(sessionCopy, t, sess.User, req.Edits)
+	writeRevision(w, revision, err)
+}
+
+func TranslationRevert(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	var req TranslationRevertRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, sess, ok := authorizeTranslation(h, w, r, req.TranslationId, account.AccessEditor)
+
+	if !ok {
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	revision, err := account.RevertTranslation(sessionCopy, t, sess.User, req.Revision)
+	writeRevision(w, revision, err)
+}
+
+func TranslationRevisions(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	t, _, ok := authorizeTranslation(h, w, r, r.URL.Query().Get("id"), account.AccessViewer)
+
+	if !ok {
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	revisions, err := account.ListRevisions(sessionCopy, t)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	serialized, err := json.Marshal(revisions)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "%s", string(serialized))
+}
+
+func TranslationSpeakers(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	var req TranslationSpeakersRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, _, ok := authorizeTranslation(h, w, r, req.TranslationId, account.AccessEditor)
+
+	if !ok {
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	err = account.SetSpeakers(sessionCopy, t, req.Speakers)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "ok")
+}
+
+func TranslationSpeakersMerge(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	var req TranslationSpeakersMergeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, sess, ok := authorizeTranslation(h, w, r, req.TranslationId, account.AccessEditor)
+
+	if !ok {
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	revision, err := account.MergeSpeakers(sessionCopy, t, sess.User, req.From, req.Into)
+	writeRevision(w, revision, err)
+}
+
+func TranslationMetadata(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	var req TranslationMetadataRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, _, ok := authorizeTranslation(h, w, r, req.TranslationId, account.AccessEditor)
+
+	if !ok {
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	err = account.SetMetadata(sessionCopy, t, req.Metadata)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "ok")
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"speech-to-text-back/src/server/account"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func cueOptionsFromQuery(r *http.Request) (account.CueOptions, error) {
+	options := account.DefaultCueOptions
+	query := r.URL.Query()
+
+	if s := query.Get("maxDuration"); len(s) > 0 {
+		seconds, err := strconv.ParseFloat(s, 64)
+		if err != nil || seconds <= 0 {
+			return options, fmt.Errorf("Invalid query param for maxDuration: %s", s)
+		}
+		options.MaxDuration = time.Duration(seconds * float64(time.Second))
+	}
+
+	if s := query.Get("maxChars"); len(s) > 0 {
+		maxChars, err := strconv.Atoi(s)
+		if err != nil || maxChars <= 0 {
+			return options, fmt.Errorf("Invalid query param for maxChars: %s", s)
+		}
+		options.MaxChars = maxChars
+	}
+
+	if s := query.Get("speakers"); len(s) > 0 {
+		speakers, err := strconv.ParseBool(s)
+		if err != nil {
+			return options, fmt.Errorf("Invalid query param for speakers: %s", s)
+		}
+		options.Speakers = speakers
+	}
+
+	return options, nil
+}
+
+func TranslationExport(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	options, err := cueOptionsFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, _, ok := authorizeTranslation(h, w, r, r.URL.Query().Get("id"), account.AccessViewer)
+
+	if !ok {
+		return
+	}
+
+	t.ApplySpeakers()
+	cues := account.BuildCues(t.CurrentTranscripts(), options)
+	baseName := strings.TrimSuffix(t.FileName, filepath.Ext(t.FileName))
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "srt":
+		w.Header().Set("Content-Type", "application/x-subrip; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", baseName+".srt"))
+		_, _ = fmt.Fprint(w, account.RenderSRT(cues, options))
+	case "vtt":
+		w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", baseName+".vtt"))
+		_, _ = fmt.Fprint(w, account.RenderVTT(cues, options))
+	default:
+		http.Error(w, fmt.Sprintf("Unknown export format: %s", format), http.StatusBadRequest)
+	}
+}
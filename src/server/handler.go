@@ -1,15 +1,25 @@
 package server
 
 import (
+	"context"
 	"gopkg.in/mgo.v2"
 	"log"
 	"net/http"
 	"os"
+	"speech-to-text-back/src/Speech2Text"
+	"speech-to-text-back/src/server/account"
+	"strconv"
+	"time"
 )
 
 type Handler struct {
 	MongoSession *mgo.Session
-	routes       RouteTree
+	BlobStore    Speech2Text.BlobStore
+	Jobs         *Speech2Text.Queue
+	Notifier     account.Notifier
+	// TrustProxy takes client addresses from the X-Forwarded-For header
+	TrustProxy bool
+	routes     RouteTree
 }
 
 func NewHandler() *Handler {
@@ -22,27 +32,177 @@ func NewHandler() *Handler {
 
 	h.MongoSession = session
 
+	account.SessionIdleTimeout = durationEnv("SESSION_IDLE_TIMEOUT", account.SessionIdleTimeout)
+	account.SessionMaxLifetime = durationEnv("SESSION_MAX_LIFETIME", account.SessionMaxLifetime)
+	account.LoginMaxAttempts = intEnv("LOGIN_MAX_ATTEMPTS", account.LoginMaxAttempts)
+	account.LoginMaxIpAttempts = intEnv("LOGIN_MAX_IP_ATTEMPTS", account.LoginMaxIpAttempts)
+	account.LoginLockout = durationEnv("LOGIN_LOCKOUT", account.LoginLockout)
+	h.TrustProxy = os.Getenv("TRUST_PROXY") == "true"
+	if issuer := os.Getenv("TOTP_ISSUER"); len(issuer) > 0 {
+		account.TotpIssuer = issuer
+	}
+	account.PasswordResetLifetime = durationEnv("PASSWORD_RESET_LIFETIME", account.PasswordResetLifetime)
+	account.PasswordResetUrl = os.Getenv("PASSWORD_RESET_URL")
+	account.InvitationUrl = os.Getenv("INVITATION_URL")
+
+	h.Notifier, err = account.NewNotifier()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	if err = account.EnsureIndexes(session); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	if err = account.BootstrapAdmin(session, os.Getenv("ADMIN_NAME"), os.Getenv("ADMIN_PASSWORD")); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	account.Ldap, err = account.NewLdapProvider()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	account.Oidc, err = account.NewOidcProvider()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	recognizers, err := Speech2Text.NewRecognizers(context.Background())
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	blobStore, err := Speech2Text.NewBlobStore(context.Background())
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	h.BlobStore = blobStore
+
+	workers, err := strconv.Atoi(os.Getenv("WORKERS"))
+	if err != nil || workers < 1 {
+		workers = 2
+	}
+
+	h.Jobs = Speech2Text.NewQueue(session, recognizers, blobStore)
+	h.Jobs.KeepAudio = os.Getenv("KEEP_AUDIO") == "true"
+	if err = h.Jobs.Start(workers); err != nil {
+		log.Fatal(err.Error())
+	}
+
 	return h
 }
 
+// durationEnv parses the duration of the environment variable name, such as
+// "12h", or returns fallback when it is not set
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if len(value) == 0 {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Fatalf("Invalid %s: %s", name, value)
+	}
+	return duration
+}
+
+// intEnv parses the positive integer of the environment variable name, or
+// returns fallback when it is not set
+func intEnv(name string, fallback int) int {
+	value := os.Getenv(name)
+	if len(value) == 0 {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Fatalf("Invalid %s: %s", name, value)
+	}
+	return n
+}
+
 func (h *Handler) defineRoutes() {
 	h.routes.path = "/"
 	h.routes.children = make(map[string]*RouteTree)
-	h.routes.RegisterRoute("/account/login", Login)
-	h.routes.RegisterRoute("/account/create", AccountCreate)
-	h.routes.RegisterRoute("/account/all", AccountList)
+	h.routes.RegisterPublicRoute("/account/login", Login)
+	h.routes.RegisterPublicRoute("/account/login/totp", LoginTotp)
+	h.routes.RegisterSessionRoute("/account/password", PasswordChange)
+	h.routes.RegisterSessionRoute("/account/email", EmailChange)
+	h.routes.RegisterPublicRoute("/account/password/forgot", PasswordForgot)
+	h.routes.RegisterPublicRoute("/account/password/reset", PasswordReset)
+	h.routes.RegisterSessionRoute("/account/totp/enroll", TotpEnroll)
+	h.routes.RegisterSessionRoute("/account/totp/confirm", TotpConfirm)
+	h.routes.RegisterSessionRoute("/account/totp/disable", TotpDisable)
+	h.routes.RegisterSessionRoute("/account/totp/recovery", TotpRecoveryCodes)
+	h.routes.RegisterPublicRoute("/oidc/login", OidcLogin)
+	h.routes.RegisterPublicRoute("/oidc/callback", OidcCallback)
+	h.routes.RegisterSessionRoute("/oidc/link", OidcLink)
+	h.routes.RegisterSessionRoute("/account/create", requireRole(account.RoleAdmin, AccountCreate))
+	h.routes.RegisterPublicRoute("/account/register", Register)
+	h.routes.RegisterSessionRoute("/account/all", requireRole(account.RoleAdmin, AccountList))
+	h.routes.RegisterSessionRoute("/sessions", SessionList)
 	h.routes.RegisterRoute("/sessions/check", SessionsCheck)
+	h.routes.RegisterSessionRoute("/sessions/logout", SessionLogout)
+	h.routes.RegisterSessionRoute("/sessions/refresh", SessionRefresh)
+	h.routes.RegisterSessionRoute("/sessions/revoke", SessionRevoke)
+	h.routes.RegisterSessionRoute("/apikeys", ApiKeyList)
+	h.routes.RegisterSessionRoute("/apikeys/create", ApiKeyCreate)
+	h.routes.RegisterSessionRoute("/apikeys/revoke", ApiKeyRevoke)
 	h.routes.RegisterRoute("/translations/one", OneTranslation)
-	h.routes.RegisterRoute("/translations/share", TranslationShare)
-	h.routes.RegisterRoute("/translations/delete", TranslationDelete)
+	h.routes.RegisterRoute("/translations/status", TranslationStatus)
+	h.routes.RegisterRoute("/translations/export", TranslationExport)
+	h.routes.RegisterRoute("/translations/edit", TranslationEdit)
+	h.routes.RegisterRoute("/translations/revisions", TranslationRevisions)
+	h.routes.RegisterRoute("/translations/revert", TranslationRevert)
+	h.routes.RegisterRoute("/translations/speakers", TranslationSpeakers)
+	h.routes.RegisterRoute("/translations/speakers/merge", TranslationSpeakersMerge)
+	h.routes.RegisterRoute("/translations/metadata", TranslationMetadata)
+	h.routes.RegisterRoute("/translations/search", TranslationSearch)
+	h.routes.RegisterSessionRoute("/translations/share", TranslationShare)
+	h.routes.RegisterRoute("/translations/shares", TranslationShares)
+	h.routes.RegisterSessionRoute("/translations/shares/update", TranslationSharesUpdate)
+	h.routes.RegisterSessionRoute("/translations/shares/revoke", TranslationSharesRevoke)
+	h.routes.RegisterSessionRoute("/translations/delete", TranslationDelete)
+	h.routes.RegisterRoute("/translations/team", TranslationTeam)
+	h.routes.RegisterRoute("/translations/move", TranslationMove)
+	h.routes.RegisterRoute("/translations/tags", TranslationTags)
+	h.routes.RegisterRoute("/projects", ProjectList)
+	h.routes.RegisterRoute("/projects/create", ProjectCreate)
+	h.routes.RegisterRoute("/projects/rename", ProjectRename)
+	h.routes.RegisterRoute("/projects/move", ProjectMove)
+	h.routes.RegisterRoute("/projects/delete", ProjectDelete)
 	h.routes.RegisterRoute("/me", MyAccount)
-	h.routes.RegisterRoute("/upload", UploadWS)
+	h.routes.RegisterRoute("/teams", TeamList)
+	h.routes.RegisterRoute("/teams/one", OneTeam)
+	h.routes.RegisterSessionRoute("/teams/create", requireRole(account.RoleMember, TeamCreate))
+	h.routes.RegisterSessionRoute("/teams/delete", TeamDelete)
+	h.routes.RegisterSessionRoute("/teams/members/add", TeamMemberAdd)
+	h.routes.RegisterSessionRoute("/teams/members/update", TeamMemberUpdate)
+	h.routes.RegisterSessionRoute("/teams/members/remove", TeamMemberRemove)
+	// Uploads need their own scope, write does not cover them
+	h.routes.RegisterRoute("/upload", requireRole(account.RoleMember, UploadWS)).scope = account.ScopeUpload
+	h.routes.RegisterRoute("/translations/links", TranslationLinks)
+	h.routes.RegisterSessionRoute("/translations/links/create", TranslationLinksCreate)
+	h.routes.RegisterSessionRoute("/translations/links/revoke", TranslationLinksRevoke)
+	h.routes.RegisterPublicRoute("/public/translation", PublicTranslation)
+	h.routes.RegisterPublicRoute("/public/audio", PublicAudio)
+	h.routes.RegisterSessionRoute("/admin/accounts/disable", requireRole(account.RoleAdmin, AdminDisableAccount))
+	h.routes.RegisterSessionRoute("/admin/accounts/enable", requireRole(account.RoleAdmin, AdminEnableAccount))
+	h.routes.RegisterSessionRoute("/admin/accounts/password", requireRole(account.RoleAdmin, AdminResetPassword))
+	h.routes.RegisterSessionRoute("/admin/accounts/role", requireRole(account.RoleAdmin, AdminChangeRole))
+	h.routes.RegisterSessionRoute("/admin/accounts/unlock", requireRole(account.RoleAdmin, AdminUnlockAccount))
+	h.routes.RegisterSessionRoute("/admin/accounts/totp/reset", requireRole(account.RoleAdmin, AdminResetTotp))
+	h.routes.RegisterSessionRoute("/admin/invitations", requireRole(account.RoleAdmin, AdminInvitations))
+	h.routes.RegisterSessionRoute("/admin/invitations/create", requireRole(account.RoleAdmin, AdminInvitationCreate))
+	h.routes.RegisterSessionRoute("/admin/invitations/revoke", requireRole(account.RoleAdmin, AdminInvitationRevoke))
+	h.routes.RegisterSessionRoute("/admin/audit", requireRole(account.RoleAdmin, AdminAudit))
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Access-Control-Allow-Origin", "*")
 	w.Header().Add("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Add("Access-Control-Allow-Headers", "Content-Type, Access-Control-Allow-Headers, Authorization, X-Requested-With")
+	w.Header().Add("Access-Control-Allow-Headers", "Content-Type, Access-Control-Allow-Headers, Authorization, X-Requested-With, X-Share-Password")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"speech-to-text-back/src/server/account"
+	"strconv"
+	"time"
+)
+
+type TranslationLinksCreateRequest struct {
+	TranslationId string    `json:"translationId"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+	Password      string    `json:"password"`
+	Audio         bool      `json:"audio"`
+}
+
+type TranslationLinksCreateResponse struct {
+	Token string             `json:"token"`
+	Link  *account.ShareLink `json:"link"`
+}
+
+type TranslationLinksRevokeRequest struct {
+	LinkId string `json:"linkId"`
+}
+
+func TranslationLinksCreate(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	var req TranslationLinksCreateRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, sess, ok := authorizeTranslation(h, w, r, req.TranslationId, account.AccessOwner)
+
+	if !ok {
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	link, token, err := account.CreateShareLink(sessionCopy, t, sess.User, req.ExpiresAt, req.Password, req.Audio)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	serialized, err := json.Marshal(TranslationLinksCreateResponse{Token: token, Link: link})
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "%s", string(serialized))
+}
+
+func TranslationLinks(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	t, _, ok := authorizeTranslation(h, w, r, r.URL.Query().Get("id"), account.AccessOwner)
+
+	if !ok {
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	links, err := account.ListShareLinks(sessionCopy, t)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	serialized, err := json.Marshal(links)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "%s", string(serialized))
+}
+
+func TranslationLinksRevoke(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	var req TranslationLinksRevokeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sess, err := requestSession(h, r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	err = account.RevokeShareLink(sessionCopy, req.LinkId, sess.User)
+
+	if err == account.ErrLinkNotOwner {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "ok")
+}
+
+// openShareLink finds the translation of the token query parameter, the
+// password being sent in the X-Share-Password header so that it stays out
+// of the logs
+func openShareLink(h *Handler, w http.ResponseWriter, r *http.Request) (*account.ShareLink, *account.Translation, bool) {
+	password := r.Header.Get("X-Share-Password")
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	link, t, err := account.OpenShareLink(sessionCopy, r.URL.Query().Get("token"), password, clientIp(h, r))
+
+	if throttle, ok := err.(*account.ThrottleError); ok {
+		w.Header().Set("Retry-After", strconv.Itoa(throttle.RetryAfter()))
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return nil, nil, false
+	}
+
+	switch err {
+	case nil:
+		return link, t, true
+	case account.ErrInvalidLink:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case account.ErrLinkPassword:
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+	return nil, nil, false
+}
+
+func PublicTranslation(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	link, t, ok := openShareLink(h, w, r)
+
+	if !ok {
+		return
+	}
+
+	serialized, err := json.Marshal(t.Public(link))
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "%s", string(serialized))
+}
+
+func PublicAudio(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	link, t, ok := openShareLink(h, w, r)
+
+	if !ok {
+		return
+	}
+
+	if !link.Audio {
+		http.Error(w, account.ErrLinkNoAudio.Error(), http.StatusForbidden)
+		return
+	}
+
+	if len(t.Audio) == 0 {
+		http.Error(w, "The audio of this translation was not kept", http.StatusNotFound)
+		return
+	}
+
+	data, err := h.BlobStore.Get(r.Context(), t.Audio)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if contentType := mime.TypeByExtension(filepath.Ext(t.FileName)); len(contentType) > 0 {
+		w.Header().Set("Content-Type", contentType)
+	}
+	http.ServeContent(w, r, t.FileName, link.CreatedAt, bytes.NewReader(data))
+}
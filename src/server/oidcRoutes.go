@@ -0,0 +1,137 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"speech-to-text-back/src/server/account"
+)
+
+type OidcLinkResponse struct {
+	Url string `json:"url"`
+}
+
+// OidcLogin sends the browser to the identity provider, which comes back to
+// OidcCallback
+func OidcLogin(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" || account.Oidc == nil {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	authUrl, err := account.Oidc.AuthorizationUrl(r.Context(), sessionCopy, r.URL.Query().Get("redirect"), "")
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, authUrl, http.StatusFound)
+}
+
+// OidcLink returns the URL linking the account of the session to the
+// identity the user logs in with
+func OidcLink(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" || account.Oidc == nil {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	sess, err := requestSession(h, r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	authUrl, err := account.Oidc.AuthorizationUrl(r.Context(), sessionCopy, r.URL.Query().Get("redirect"), sess.User)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	serialized, err := json.Marshal(OidcLinkResponse{Url: authUrl})
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "%s", string(serialized))
+}
+
+// OidcCallback opens a session for the user coming back from the identity
+// provider, and gives its token to the front-end in the URL fragment
+func OidcCallback(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" || account.Oidc == nil {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	if errCode := query.Get("error"); len(errCode) > 0 {
+		http.Error(w, fmt.Sprintf("%s %s", errCode, query.Get("error_description")), http.StatusBadRequest)
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	a, redirect, err := account.Oidc.Callback(r.Context(), sessionCopy, query.Get("code"), query.Get("state"))
+
+	if err == account.ErrAccountDisabled {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if a.TotpEnabled && len(redirect) == 0 {
+		writeMfaChallenge(w, sessionCopy, a)
+		return
+	}
+
+	if a.TotpEnabled {
+		mfaToken, err := account.CreateMfaChallenge(sessionCopy, a.Id)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		http.Redirect(w, r, redirect+"#mfa_token="+url.QueryEscape(mfaToken), http.StatusFound)
+		return
+	}
+
+	session, err := account.CreateSession(a.Id, sessionCopy, r.UserAgent(), clientIp(h, r))
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(redirect) > 0 {
+		http.Redirect(w, r, redirect+"#token="+url.QueryEscape(session.Token), http.StatusFound)
+		return
+	}
+
+	serialized, err := json.Marshal(session)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "%s", string(serialized))
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/mgo.v2"
+	"log"
+	"net/http"
+	"speech-to-text-back/src/server/account"
+	"strconv"
+)
+
+type PasswordChangeRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+type PasswordForgotRequest struct {
+	// Name or email of the account
+	Name string `json:"name"`
+}
+
+type EmailChangeRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	Email           string `json:"email"`
+}
+
+type PasswordResetRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func PasswordChange(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	var req PasswordChangeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sess, err := requestSession(h, r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	err = account.ChangePassword(sessionCopy, sess, req.CurrentPassword, req.NewPassword)
+
+	if err == account.ErrWrongPassword {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "ok")
+}
+
+// PasswordForgot sends a reset link to the account, and answers the same
+// whether it exists or not. The link is looked up and sent in the
+// background, so that the time taken tells nothing either.
+func PasswordForgot(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	var req PasswordForgotRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	err = account.CountPasswordResetRequest(sessionCopy, req.Name, clientIp(h, r))
+
+	if throttle, ok := err.(*account.ThrottleError); ok {
+		w.Header().Set("Retry-After", strconv.Itoa(throttle.RetryAfter()))
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	go func(mongoSession *mgo.Session) {
+		defer mongoSession.Close()
+		if err := account.RequestPasswordReset(mongoSession, h.Notifier, req.Name); err != nil {
+			log.Println(err)
+		}
+	}(h.MongoSession.Copy())
+
+	_, _ = fmt.Fprintf(w, "ok")
+}
+
+func PasswordReset(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	var req PasswordResetRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	err = account.ResetPasswordWithToken(sessionCopy, req.Token, req.Password)
+
+	if err == account.ErrInvalidResetToken || err == account.ErrAccountDisabled {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "ok")
+}
+
+func EmailChange(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	var req EmailChangeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sess, err := requestSession(h, r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	err = account.SetEmail(sessionCopy, sess.User, req.CurrentPassword, req.Email)
+
+	if err == account.ErrWrongPassword {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "ok")
+}
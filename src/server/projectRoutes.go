@@ -0,0 +1,240 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"speech-to-text-back/src/server/account"
+)
+
+type ProjectRequest struct {
+	ProjectId string `json:"projectId"`
+	Name      string `json:"name"`
+	ParentId  string `json:"parentId"`
+	TeamId    string `json:"teamId"`
+}
+
+type TranslationMoveRequest struct {
+	TranslationId string `json:"translationId"`
+	// ProjectId is empty to take the translation out of its project
+	ProjectId string `json:"projectId"`
+}
+
+type TranslationTagsRequest struct {
+	TranslationId string   `json:"translationId"`
+	Tags          []string `json:"tags"`
+}
+
+// projectRoute decodes a ProjectRequest and runs action with the session user
+func projectRoute(action func(h *Handler, sess *account.Session, req *ProjectRequest) error) route {
+	return func(h *Handler, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+
+		var req ProjectRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		sess, err := requestSession(h, r)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		err = action(h, sess, &req)
+
+		if err == account.ErrProjectForbidden {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		_, _ = fmt.Fprintf(w, "ok")
+	}
+}
+
+func ProjectList(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	sess, err := requestSession(h, r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	projects, err := account.ListProjects(sessionCopy, sess.User)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	serialized, err := json.Marshal(projects)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "%s", string(serialized))
+}
+
+func ProjectCreate(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	var req ProjectRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sess, err := requestSession(h, r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	project, err := account.CreateProject(sessionCopy, sess.User, req.Name, req.ParentId, req.TeamId)
+
+	if err == account.ErrProjectForbidden || err == account.ErrNotTeamMember {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	serialized, err := json.Marshal(project)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "%s", string(serialized))
+}
+
+var ProjectRename = projectRoute(func(h *Handler, sess *account.Session, req *ProjectRequest) error {
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+	return account.RenameProject(sessionCopy, sess.User, req.ProjectId, req.Name)
+})
+
+var ProjectMove = projectRoute(func(h *Handler, sess *account.Session, req *ProjectRequest) error {
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+	return account.MoveProject(sessionCopy, sess.User, req.ProjectId, req.ParentId)
+})
+
+var ProjectDelete = projectRoute(func(h *Handler, sess *account.Session, req *ProjectRequest) error {
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+	return account.DeleteProject(sessionCopy, sess.User, req.ProjectId)
+})
+
+func TranslationMove(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	var req TranslationMoveRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, sess, ok := authorizeTranslation(h, w, r, req.TranslationId, account.AccessEditor)
+
+	if !ok {
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	err = account.MoveTranslation(sessionCopy, t, sess.User, req.ProjectId)
+
+	if err == account.ErrProjectForbidden {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "ok")
+}
+
+func TranslationTags(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	var req TranslationTagsRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, _, ok := authorizeTranslation(h, w, r, req.TranslationId, account.AccessEditor)
+
+	if !ok {
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	tags, err := account.SetTags(sessionCopy, t, req.Tags)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	serialized, err := json.Marshal(tags)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "%s", string(serialized))
+}
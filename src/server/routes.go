@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"github.com/gorilla/websocket"
 	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
-	"gopkg.in/mgo.v2/bson"
 	"io"
 	"log"
 	"net/http"
@@ -23,12 +22,24 @@ func MyAccount(h *Handler, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	auth := r.Header.Get("Authorization")
+	sess, err := requestSession(h, r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 
 	sessionCopy := h.MongoSession.Copy()
 	defer sessionCopy.Close()
 
-	a, err := account.FullAccount(sessionCopy, auth)
+	filter, err := account.NewTranslationFilter(sessionCopy, sess.User, r.URL.Query().Get("project"), r.URL.Query().Get("tag"))
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a, err := account.FullAccount(sessionCopy, sess.User, filter)
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -81,33 +92,86 @@ func OneTranslation(h *Handler, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	auth := r.Header.Get("Authorization")
+	t, _, ok := authorizeTranslation(h, w, r, r.URL.Query().Get("id"), account.AccessViewer)
 
-	sessionCopy := h.MongoSession.Copy()
-	defer sessionCopy.Close()
-	sessOid := bson.ObjectIdHex(auth)
-	collection := sessionCopy.DB("s2t").C("sessions")
-	var sess account.Session
-	err := collection.FindId(sessOid).One(&sess)
+	if !ok {
+		return
+	}
+
+	t.ApplySpeakers()
+	serialized, err := json.Marshal(t)
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	collection = sessionCopy.DB("s2t").C("translations")
+	_, _ = fmt.Fprintf(w, "%s", string(serialized))
+}
 
-	queryId := r.URL.Query()["id"][0]
+func TranslationStatus(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
 
-	var t account.Translation
-	err = collection.FindId(bson.ObjectIdHex(queryId)).One(&t)
+	t, _, ok := authorizeTranslation(h, w, r, r.URL.Query().Get("id"), account.AccessViewer)
+
+	if !ok {
+		return
+	}
+
+	serialized, err := json.Marshal(account.GetTranslationStatus(t))
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	serialized, err := json.Marshal(t)
+	_, _ = fmt.Fprintf(w, "%s", string(serialized))
+}
+
+func TranslationSearch(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	limit := 100
+	if limitStr := r.URL.Query().Get("limit"); len(limitStr) > 0 {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid query param for limit: %s", limitStr), http.StatusBadRequest)
+			return
+		}
+	}
+
+	sess, err := requestSession(h, r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	filter, err := account.NewTranslationFilter(sessionCopy, sess.User, r.URL.Query().Get("project"), r.URL.Query().Get("tag"))
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hits, err := account.SearchTranslations(sessionCopy, sess.User, r.URL.Query().Get("q"), filter, limit)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	serialized, err := json.Marshal(hits)
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -120,6 +184,8 @@ func OneTranslation(h *Handler, w http.ResponseWriter, r *http.Request) {
 type TranslationShareRequest struct {
 	TranslationId  string `json:"translationId"`
 	AccountToShare string `json:"accountToShare"`
+	// Access given to the account, viewer by default
+	Access string `json:"access"`
 }
 
 func TranslationShare(h *Handler, w http.ResponseWriter, r *http.Request) {
@@ -136,10 +202,20 @@ func TranslationShare(h *Handler, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	t, _, ok := authorizeTranslation(h, w, r, a.TranslationId, account.AccessOwner)
+
+	if !ok {
+		return
+	}
+
+	if len(a.Access) == 0 {
+		a.Access = account.AccessViewer
+	}
+
 	sessionCopy := h.MongoSession.Copy()
 	defer sessionCopy.Close()
 
-	err = account.ShareTranslation(sessionCopy, &a.TranslationId, &a.AccountToShare)
+	err = account.ShareTranslation(sessionCopy, t, &a.AccountToShare, a.Access)
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -155,26 +231,26 @@ func TranslationDelete(h *Handler, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	auth := r.Header.Get("Authorization")
+	t, _, ok := authorizeTranslation(h, w, r, r.URL.Query().Get("id"), account.AccessOwner)
+
+	if !ok {
+		return
+	}
 
 	sessionCopy := h.MongoSession.Copy()
 	defer sessionCopy.Close()
-	sessOid := bson.ObjectIdHex(auth)
-	collection := sessionCopy.DB("s2t").C("sessions")
-	var sess account.Session
-	err := collection.FindId(sessOid).One(&sess)
+
+	err := account.DeleteTranslation(sessionCopy, t)
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	queryId := r.URL.Query()["id"][0]
 
-	err = account.DeleteTranslation(sessionCopy, &sess, &queryId)
-
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+	if len(t.Audio) > 0 {
+		if err = h.BlobStore.Delete(r.Context(), t.Audio); err != nil {
+			log.Println(err)
+		}
 	}
 
 	_, _ = fmt.Fprintf(w, "ok")
@@ -198,6 +274,11 @@ func AccountCreate(h *Handler, w http.ResponseWriter, r *http.Request) {
 	defer sessionCopy.Close()
 	err = account.CreateAccount(&a, sessionCopy)
 
+	if err == account.ErrNameTaken {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -206,6 +287,55 @@ func AccountCreate(h *Handler, w http.ResponseWriter, r *http.Request) {
 	_, _ = fmt.Fprintf(w, "Account created")
 }
 
+type RegisterRequest struct {
+	Code     string `json:"code"`
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	Email    string `json:"email"`
+}
+
+// Register creates an account with an invitation code
+func Register(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	var req RegisterRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	err = account.Register(sessionCopy, req.Code, &account.Account{
+		Name:     req.Name,
+		Password: req.Password,
+		Email:    req.Email,
+	})
+
+	if err == account.ErrNameTaken {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err == account.ErrInvalidInvitation {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "Account created")
+}
+
 func Login(h *Handler, w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "404 not found.", http.StatusNotFound)
@@ -223,19 +353,67 @@ func Login(h *Handler, w http.ResponseWriter, r *http.Request) {
 	sessionCopy := h.MongoSession.Copy()
 	defer sessionCopy.Close()
 
+	ip := clientIp(h, r)
+	attempt, err := account.BeginLoginAttempt(sessionCopy, a.Name, ip)
+
+	// Throttled logins are refused like wrong passwords, locks being
+	// counted for unknown names as well
+	if throttle, ok := err.(*account.ThrottleError); ok {
+		w.Header().Set("Retry-After", strconv.Itoa(throttle.RetryAfter()))
+		http.Error(w, account.ErrInvalidCredentials.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	id, err := account.IdentifyAccount(&a, sessionCopy)
 
+	if account.IsCredentialError(err) || (err == nil && id == nil) {
+		if err == nil {
+			err = account.ErrInvalidCredentials
+		}
+		if recordErr := account.RecordLoginFailure(sessionCopy, attempt, r.UserAgent(), err); recordErr != nil {
+			log.Println(recordErr)
+		}
+		http.Error(w, account.ErrInvalidCredentials.Error(), http.StatusForbidden)
+		return
+	}
+
+	if cancelErr := account.CancelLoginAttempt(sessionCopy, attempt); cancelErr != nil {
+		log.Println(cancelErr)
+	}
+
+	// Only given with the right password
+	if err == account.ErrAccountDisabled || err == account.ErrNotAllowed {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if id == nil {
-		http.Error(w, "Invalid password", http.StatusForbidden)
+	user, err := account.FindAccount(sessionCopy, *id)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	session, err := account.CreateSession(*id, sessionCopy)
+	if user.TotpEnabled {
+		writeMfaChallenge(w, sessionCopy, user)
+		return
+	}
+
+	if err = account.RecordLoginSuccess(sessionCopy, a.Name); err != nil {
+		log.Println(err)
+	}
+
+	session, err := account.CreateSession(*id, sessionCopy, r.UserAgent(), clientIp(h, r))
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -295,11 +473,9 @@ func UploadWS(h *Handler, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	auth := r.URL.Query().Get("Authorization")
-
 	sessionCopy := h.MongoSession.Copy()
 	defer sessionCopy.Close()
-	session, err := account.FindSession(sessionCopy, auth)
+	session, err := requestSession(h, r)
 
 	if err != nil {
 		log.Println(err)
@@ -313,15 +489,23 @@ func UploadWS(h *Handler, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newTranslation, err := account.CreateTranslation(sessionCopy, fileName, session.User)
+	model := r.URL.Query().Get("model")
+	language := r.URL.Query().Get("language")
+
+	newTranslation, err := account.CreateTranslation(sessionCopy, account.Upload{
+		FileName:        fileName,
+		Size:            int64(sizeInt),
+		Encoding:        audioType.String(),
+		SampleRateHertz: int32(sampleRateHertz),
+		Language:        language,
+		Model:           model,
+		PacketSize:      packetInt,
+	}, session.User)
 
 	if err != nil {
 		log.Println(err)
 		return
 	}
 
-	model := r.URL.Query().Get("model")
-	language := r.URL.Query().Get("language")
-
 	streamS2t(h, fileName, conn, sizeInt, newTranslation, packetInt, sampleRateHertz, audioType, language, model)
 }
@@ -1,18 +1,54 @@
 package server
 
 import (
+	"context"
 	"net/http"
 	"speech-to-text-back/src/server/account"
 	"strings"
 )
 
+type contextKey int
+
+// sessionKey holds the *account.Session of a request in its context
+const sessionKey contextKey = 0
+
+type route func(*Handler, http.ResponseWriter, *http.Request)
+
 type RouteTree struct {
 	path     string
 	children map[string]*RouteTree
-	cb       func(*Handler, http.ResponseWriter, *http.Request)
+	cb       route
+	// public routes are served without session
+	public bool
+	// sessionOnly routes cannot be used with API keys
+	sessionOnly bool
+	// scope an API key needs for the route, read for GET requests and
+	// write for others when empty
+	scope string
+}
+
+// RegisterPublicRoute registers a route that does not require a session
+func (t *RouteTree) RegisterPublicRoute(path string, cb route) {
+	t.RegisterRoute(path, cb).public = true
+}
+
+// RegisterSessionRoute registers a route that requires a login session
+// rather than an API key
+func (t *RouteTree) RegisterSessionRoute(path string, cb route) {
+	t.RegisterRoute(path, cb).sessionOnly = true
+}
+
+func (t *RouteTree) requiredScope(r *http.Request) string {
+	if len(t.scope) > 0 {
+		return t.scope
+	}
+	if r.Method == "GET" {
+		return account.ScopeRead
+	}
+	return account.ScopeWrite
 }
 
-func (t *RouteTree) RegisterRoute(path string, cb func(*Handler, http.ResponseWriter, *http.Request)) {
+func (t *RouteTree) RegisterRoute(path string, cb route) *RouteTree {
 	branch := t
 	trim := strings.Trim(path, "/")
 	split := strings.Split(trim, "/")
@@ -31,6 +67,7 @@ func (t *RouteTree) RegisterRoute(path string, cb func(*Handler, http.ResponseWr
 		}
 	}
 	branch.cb = cb
+	return branch
 }
 
 func (t *RouteTree) findPath(path []string, index int) *RouteTree {
@@ -48,13 +85,15 @@ func (t *RouteTree) ExecuteQuery(h *Handler, w http.ResponseWriter, r *http.Requ
 	trim := strings.Trim(r.URL.Path, "/")
 	split := strings.Split(trim, "/")
 
-	if split[0] != "account" {
-		sessId := r.Header.Get("Authorization")
-		if len(sessId) == 0 {
-			sessId = r.URL.Query().Get("Authorization")
-		}
-		ok, err := account.CheckSession(sessId, h.MongoSession)
-		if !ok {
+	subBranch := t.findPath(split, 0)
+	if subBranch == nil || subBranch.cb == nil {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	if !subBranch.public {
+		session, err := subBranch.checkToken(h, r)
+		if session == nil {
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusForbidden)
 			} else {
@@ -62,11 +101,31 @@ func (t *RouteTree) ExecuteQuery(h *Handler, w http.ResponseWriter, r *http.Requ
 			}
 			return
 		}
+		r = r.WithContext(context.WithValue(r.Context(), sessionKey, session))
 	}
 
-	if subBranch := t.findPath(split, 0); subBranch != nil {
-		subBranch.cb(h, w, r)
-	} else {
-		http.Error(w, "404 not found.", http.StatusNotFound)
+	subBranch.cb(h, w, r)
+}
+
+// checkToken returns the session of the request token, or one standing for
+// its API key when the key can be used for the route
+func (t *RouteTree) checkToken(h *Handler, r *http.Request) (*account.Session, error) {
+	token := requestToken(r)
+	if !account.IsApiKey(token) {
+		return account.CheckSession(token, h.MongoSession)
+	}
+
+	if t.sessionOnly {
+		return nil, account.ErrApiKeyScope
+	}
+
+	key, err := account.CheckApiKey(token, h.MongoSession)
+	if err != nil {
+		return nil, err
+	}
+
+	if !key.Allows(t.requiredScope(r)) {
+		return nil, account.ErrApiKeyScope
 	}
+	return key.Session(), nil
 }
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"speech-to-text-back/src/server/account"
+)
+
+type TranslationSharesUpdateRequest struct {
+	TranslationId string `json:"translationId"`
+	Account       string `json:"account"`
+	Access        string `json:"access"`
+}
+
+type TranslationSharesRevokeRequest struct {
+	TranslationId string `json:"translationId"`
+	Account       string `json:"account"`
+}
+
+func TranslationShares(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	t, _, ok := authorizeTranslation(h, w, r, r.URL.Query().Get("id"), account.AccessOwner)
+
+	if !ok {
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	shares, err := account.ListShares(sessionCopy, t)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	serialized, err := json.Marshal(shares)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "%s", string(serialized))
+}
+
+func TranslationSharesUpdate(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	var req TranslationSharesUpdateRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, _, ok := authorizeTranslation(h, w, r, req.TranslationId, account.AccessOwner)
+
+	if !ok {
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	err = account.UpdateShare(sessionCopy, t, req.Account, req.Access)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "ok")
+}
+
+func TranslationSharesRevoke(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	var req TranslationSharesRevokeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, _, ok := authorizeTranslation(h, w, r, req.TranslationId, account.AccessOwner)
+
+	if !ok {
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	err = account.RevokeShare(sessionCopy, t, req.Account)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "ok")
+}
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"speech-to-text-back/src/server/account"
+)
+
+type TeamRequest struct {
+	TeamId  string `json:"teamId"`
+	Name    string `json:"name"`
+	Account string `json:"account"`
+	Role    string `json:"role"`
+}
+
+type TranslationTeamRequest struct {
+	TranslationId string `json:"translationId"`
+	// TeamId is empty to take the translation out of its team
+	TeamId string `json:"teamId"`
+}
+
+// teamRoute decodes a TeamRequest and runs action with the session user
+func teamRoute(action func(h *Handler, sess *account.Session, req *TeamRequest) error) route {
+	return func(h *Handler, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+
+		var req TeamRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		sess, err := requestSession(h, r)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		err = action(h, sess, &req)
+
+		if err == account.ErrNotTeamManager || err == account.ErrNotTeamMember {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		_, _ = fmt.Fprintf(w, "ok")
+	}
+}
+
+func TeamList(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	sess, err := requestSession(h, r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	teams, err := account.ListTeams(sessionCopy, sess.User)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	serialized, err := json.Marshal(teams)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "%s", string(serialized))
+}
+
+func OneTeam(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	sess, err := requestSession(h, r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	team, err := account.MemberTeam(sessionCopy, r.URL.Query().Get("id"), sess.User)
+
+	if err == account.ErrNotTeamMember {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err == nil {
+		err = account.FillMemberNames(sessionCopy, team)
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	serialized, err := json.Marshal(team)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "%s", string(serialized))
+}
+
+func TeamCreate(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	var req TeamRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sess, err := requestSession(h, r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	team, err := account.CreateTeam(sessionCopy, sess.User, req.Name)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	serialized, err := json.Marshal(team)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "%s", string(serialized))
+}
+
+var TeamMemberAdd = teamRoute(func(h *Handler, sess *account.Session, req *TeamRequest) error {
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+	team, err := account.ManagedTeam(sessionCopy, req.TeamId, sess.User)
+	if err != nil {
+		return err
+	}
+	return account.AddTeamMember(sessionCopy, team, req.Account, req.Role)
+})
+
+var TeamMemberUpdate = teamRoute(func(h *Handler, sess *account.Session, req *TeamRequest) error {
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+	team, err := account.ManagedTeam(sessionCopy, req.TeamId, sess.User)
+	if err != nil {
+		return err
+	}
+	return account.UpdateTeamMember(sessionCopy, team, req.Account, req.Role)
+})
+
+// TeamMemberRemove lets managers remove members, and members leave
+var TeamMemberRemove = teamRoute(func(h *Handler, sess *account.Session, req *TeamRequest) error {
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+	team, err := account.MemberTeam(sessionCopy, req.TeamId, sess.User)
+	if err != nil {
+		return err
+	}
+	if req.Account != sess.User.Hex() && team.RoleOf(sess.User) != account.TeamRoleManager {
+		return account.ErrNotTeamManager
+	}
+	return account.RemoveTeamMember(sessionCopy, team, req.Account)
+})
+
+var TeamDelete = teamRoute(func(h *Handler, sess *account.Session, req *TeamRequest) error {
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+	team, err := account.ManagedTeam(sessionCopy, req.TeamId, sess.User)
+	if err != nil {
+		return err
+	}
+	return account.DeleteTeam(sessionCopy, team)
+})
+
+// TranslationTeam moves a translation of the session user into a team
+func TranslationTeam(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	var req TranslationTeamRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, sess, ok := authorizeTranslation(h, w, r, req.TranslationId, account.AccessOwner)
+
+	if !ok {
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	err = account.MoveToTeam(sessionCopy, t, sess.User, req.TeamId)
+
+	if err == account.ErrNotTeamMember {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "ok")
+}
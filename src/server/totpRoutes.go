@@ -0,0 +1,246 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/mgo.v2"
+	"log"
+	"net/http"
+	"speech-to-text-back/src/server/account"
+	"strconv"
+)
+
+type TotpCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type TotpRecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type LoginTotpRequest struct {
+	MfaToken string `json:"mfaToken"`
+	Code     string `json:"code"`
+}
+
+// MfaChallengeResponse answers logins of accounts with two-factor
+// authentication, completed by /account/login/totp
+type MfaChallengeResponse struct {
+	MfaRequired bool   `json:"mfa_required"`
+	MfaToken    string `json:"mfa_token"`
+}
+
+func writeMfaChallenge(w http.ResponseWriter, sessionCopy *mgo.Session, a *account.Account) {
+	token, err := account.CreateMfaChallenge(sessionCopy, a.Id)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	serialized, err := json.Marshal(MfaChallengeResponse{MfaRequired: true, MfaToken: token})
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "%s", string(serialized))
+}
+
+// totpCodeRoute decodes a TotpCodeRequest and answers with what action
+// returns for the session user
+func totpCodeRoute(action func(sessionCopy *mgo.Session, sess *account.Session, code string) (interface{}, error)) route {
+	return func(h *Handler, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+
+		var req TotpCodeRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		sess, err := requestSession(h, r)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		sessionCopy := h.MongoSession.Copy()
+		defer sessionCopy.Close()
+
+		resp, err := action(sessionCopy, sess, req.Code)
+
+		if err == account.ErrInvalidCode {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if resp == nil {
+			_, _ = fmt.Fprintf(w, "ok")
+			return
+		}
+
+		serialized, err := json.Marshal(resp)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		_, _ = fmt.Fprintf(w, "%s", string(serialized))
+	}
+}
+
+func TotpEnroll(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	sess, err := requestSession(h, r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	enrollment, err := account.EnrollTotp(sessionCopy, sess.User)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	serialized, err := json.Marshal(enrollment)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "%s", string(serialized))
+}
+
+var TotpConfirm = totpCodeRoute(func(sessionCopy *mgo.Session, sess *account.Session, code string) (interface{}, error) {
+	codes, err := account.ConfirmTotp(sessionCopy, sess.User, code)
+	if err != nil {
+		return nil, err
+	}
+	return TotpRecoveryCodesResponse{RecoveryCodes: codes}, nil
+})
+
+var TotpDisable = totpCodeRoute(func(sessionCopy *mgo.Session, sess *account.Session, code string) (interface{}, error) {
+	return nil, account.DisableTotp(sessionCopy, sess.User, code)
+})
+
+var TotpRecoveryCodes = totpCodeRoute(func(sessionCopy *mgo.Session, sess *account.Session, code string) (interface{}, error) {
+	codes, err := account.RegenerateRecoveryCodes(sessionCopy, sess.User, code)
+	if err != nil {
+		return nil, err
+	}
+	return TotpRecoveryCodesResponse{RecoveryCodes: codes}, nil
+})
+
+// LoginTotp completes a login with the second factor of the account
+func LoginTotp(h *Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+
+	var req LoginTotpRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sessionCopy := h.MongoSession.Copy()
+	defer sessionCopy.Close()
+
+	a, err := account.FindMfaChallenge(sessionCopy, req.MfaToken)
+
+	if err == account.ErrAccountDisabled || err == account.ErrInvalidMfaChallenge {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ip := clientIp(h, r)
+	attempt, err := account.BeginLoginAttempt(sessionCopy, a.Name, ip)
+
+	// Refused like wrong passwords, as in Login
+	if throttle, ok := err.(*account.ThrottleError); ok {
+		w.Header().Set("Retry-After", strconv.Itoa(throttle.RetryAfter()))
+		http.Error(w, account.ErrInvalidCredentials.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = account.CheckSecondFactor(sessionCopy, a, req.Code)
+
+	if err == account.ErrInvalidCode {
+		if recordErr := account.RecordLoginFailure(sessionCopy, attempt, r.UserAgent(), err); recordErr != nil {
+			log.Println(recordErr)
+		}
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if cancelErr := account.CancelLoginAttempt(sessionCopy, attempt); cancelErr != nil {
+		log.Println(cancelErr)
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = account.CompleteMfaChallenge(sessionCopy, req.MfaToken); err != nil {
+		log.Println(err)
+	}
+
+	if err = account.RecordLoginSuccess(sessionCopy, a.Name); err != nil {
+		log.Println(err)
+	}
+
+	session, err := account.CreateSession(a.Id, sessionCopy, r.UserAgent(), ip)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	serialized, err := json.Marshal(session)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "%s", string(serialized))
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/gorilla/websocket"
 	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
 	"log"
+	"path/filepath"
 	"speech-to-text-back/src/Speech2Text"
 	"speech-to-text-back/src/server/account"
 	"time"
@@ -48,8 +49,12 @@ func listen(conn *websocket.Conn, fileBuffer chan []byte) {
 type msgType string
 
 const (
-	dataMsg  msgType = "data"
-	errorMsg msgType = "error"
+	dataMsg        msgType = "data"
+	errorMsg       msgType = "error"
+	receivedMsg    msgType = "received"
+	uploadedMsg    msgType = "uploaded"
+	recognizingMsg msgType = "recognizing"
+	doneMsg        msgType = "done"
 )
 
 type message struct {
@@ -57,12 +62,24 @@ type message struct {
 	Msg     string  `json:"msg"`
 }
 
-func sendResp(conn *websocket.Conn, stream *Speech2Text.Stream, streamResp chan []byte, streamErr chan []byte) {
+type progressMessage struct {
+	MsgType  msgType `json:"msgType"`
+	Received int     `json:"received,omitempty"`
+	Size     int     `json:"size,omitempty"`
+	Percent  int32   `json:"percent"`
+}
+
+var progressMsgTypes = map[Speech2Text.ProgressType]msgType{
+	Speech2Text.ProgressReceived:    receivedMsg,
+	Speech2Text.ProgressUploaded:    uploadedMsg,
+	Speech2Text.ProgressRecognizing: recognizingMsg,
+	Speech2Text.ProgressDone:        doneMsg,
+}
+
+func sendResp(conn *websocket.Conn, stream *Speech2Text.Stream, streamResp chan []byte, streamErr chan []byte, streamProgress chan Speech2Text.Progress) {
 	ticker := time.NewTicker(pingPeriod)
 	defer conn.Close()
-	defer func() {
-		stream.Closed = true
-	}()
+	defer stream.Close()
 	for {
 		select {
 		case msg := <-streamResp:
@@ -105,6 +122,26 @@ func sendResp(conn *websocket.Conn, stream *Speech2Text.Stream, streamResp chan
 
 			serialized, err := json.Marshal(endMessage)
 
+			_, _ = w.Write(serialized)
+			if err := w.Close(); err != nil {
+				return
+			}
+		case progress := <-streamProgress:
+			_ = conn.SetWriteDeadline(time.Now().Add(writeWait))
+			w, err := conn.NextWriter(websocket.TextMessage)
+			if err != nil {
+				return
+			}
+
+			endMessage := progressMessage{
+				MsgType:  progressMsgTypes[progress.Type],
+				Received: progress.Received,
+				Size:     progress.Size,
+				Percent:  progress.Percent,
+			}
+
+			serialized, err := json.Marshal(endMessage)
+
 			_, _ = w.Write(serialized)
 			if err := w.Close(); err != nil {
 				return
@@ -131,10 +168,23 @@ func streamS2t(h *Handler,
 	initWs(conn, int64(packetSize))
 	ctx := context.Background()
 
+	config := Speech2Text.RecognitionConfig{
+		Encoding:        audioType,
+		SampleRateHertz: int32(sampleRateHertz),
+		Language:        language,
+		Model:           model,
+	}
+	blob := newTranslation.Id.Hex() + filepath.Ext(fileName)
+	job, err := Speech2Text.CreateJob(h.MongoSession, newTranslation.Id, blob, config)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
 	fileBuffer := make(chan []byte)
-	s := Speech2Text.NewStream(ctx, fileName, fileBuffer, h.MongoSession, newTranslation, size, sampleRateHertz, audioType, language, model)
+	s := Speech2Text.NewStream(ctx, fileBuffer, h.Jobs, job, size)
 
 	go listen(conn, fileBuffer)
-	go sendResp(conn, &s, s.StreamResp, s.StreamErr)
+	go sendResp(conn, &s, s.StreamResp, s.StreamErr, s.StreamProgress)
 	s.Start()
 }